@@ -0,0 +1,52 @@
+package datasource
+
+import (
+	"time"
+
+	"xorm.io/xorm"
+)
+
+// AccessAudit 跨系统访问数据源的审计事件，持久化时保存在access_audit表(使用引擎的表名前缀)
+type AccessAudit struct {
+	Id         int64  `xorm:"pk autoincr bigint"`
+	SystemId   string `xorm:"varchar(64) not null index" json:"systemId"` // 访问方的系统标示
+	DsID       string `xorm:"varchar(64) not null index" json:"dsID"`     // 被访问的数据源标示
+	Granted    bool   `xorm:"not null" json:"granted"`
+	ReadOnly   bool   `xorm:"not null" json:"readOnly"`
+	Reason     string `xorm:"varchar(255)" json:"reason"` // 拒绝访问的原因
+	CreateTime int64  `xorm:"bigint not null index" json:"createTime"`
+}
+
+/**
+ * 将跨系统访问数据源的审计事件持久化到orm对应数据库的审计表中，审计表不存在时自动创建。
+ * 未调用时审计事件只输出到日志。
+ */
+func (d *dataSource) Audit(orm *xorm.Engine) error {
+	if err := orm.Sync2(new(AccessAudit)); err != nil {
+		return err
+	}
+	d.lock.Lock()
+	d.auditOrm = orm
+	d.lock.Unlock()
+	return nil
+}
+
+// audit 记录审计事件，写入审计表失败时只记录错误，不影响数据源的获取
+func (d *dataSource) audit(event AccessAudit) {
+	event.CreateTime = time.Now().Unix()
+	keyvals := []interface{}{"event", "datasource_access", "caller", event.SystemId, "dsID", event.DsID,
+		"granted", event.Granted, "readOnly", event.ReadOnly, "reason", event.Reason, "createTime", event.CreateTime}
+	if event.Granted {
+		d.logger.Info("跨系统访问数据源", keyvals...)
+	} else {
+		d.logger.Warn("跨系统访问数据源", keyvals...)
+	}
+	d.lock.RLock()
+	orm := d.auditOrm
+	d.lock.RUnlock()
+	if orm != nil {
+		if _, err := orm.Insert(&event); err != nil {
+			d.logger.Error(err, "写入审计事件失败", "dsID", event.DsID)
+		}
+	}
+}
@@ -2,10 +2,13 @@ package base
 
 import (
 	"context"
-	"math/rand"
+	"fmt"
+	"reflect"
+	"strings"
 
 	"github.com/aluka-7/common"
 	"github.com/aluka-7/datasource/search"
+	"go.opentelemetry.io/otel/trace"
 	"xorm.io/xorm"
 )
 
@@ -20,38 +23,140 @@ type IBaseRepository interface {
 	TxUpdate(tx *xorm.Session, id int64, bean interface{}, cols ...string) (int64, error)
 }
 
+// IExtendedRepository 在IBaseRepository的基础上增加检索、聚合、遍历和带上下文的写操作，BaseRepository实现了该接口，
+// IBaseRepository保持不变以兼容已有的实现和mock
+type IExtendedRepository interface {
+	IBaseRepository
+	SaveContext(ctx context.Context, bean interface{}) (int64, error)
+	UpdateContext(ctx context.Context, id int64, bean interface{}, cols ...string) (int64, error)
+	Delete(ctx context.Context, id int64, bean interface{}) (int64, error)
+	Search(ctx context.Context, query search.Query, list interface{}, count interface{}, cols ...string) (page *common.Pagination, err error)
+	Aggregate(ctx context.Context, cq common.Query, bean interface{}, groupBy []search.GroupBy, aggregates []search.Aggregate, rows interface{}) error
+	Iterate(ctx context.Context, cq common.Query, bean interface{}, fn func(bean interface{}) error, cols ...string) error
+	IterateBatch(ctx context.Context, cq common.Query, bean interface{}, size int, fn func(batch interface{}) error, cols ...string) error
+	TxSaveContext(ctx context.Context, tx *xorm.Session, bean interface{}) (int64, error)
+	TxUpdateContext(ctx context.Context, tx *xorm.Session, id int64, bean interface{}, cols ...string) (int64, error)
+}
+
 func NewBaseRepository(orm *xorm.Engine, sorm []*xorm.Engine, column map[string]search.Filter) BaseRepository {
-	return BaseRepository{orm: orm, sorm: sorm, column: column}
+	return BaseRepository{resolver: StaticResolver(orm, sorm), column: column}
+}
+
+// NewResolverRepository 通过resolver按照上下文获取主库和只读库，如数据库或schema按租户隔离时使用
+func NewResolverRepository(resolver EngineResolver, column map[string]search.Filter) BaseRepository {
+	return BaseRepository{resolver: resolver, column: column}
 }
 
 type BaseRepository struct {
-	orm    *xorm.Engine
-	sorm   []*xorm.Engine
-	column map[string]search.Filter
+	resolver EngineResolver
+	column   map[string]search.Filter
+	tenant   bool         // 租户模式，见NewTenantRepository
+	tracer   trace.Tracer // 不为nil时记录链路追踪，见Traced
 }
 
+// Xorm 不带上下文获取主库，resolver需要上下文(如按租户路由)时返回nil
 func (b *BaseRepository) Xorm() *xorm.Engine {
-	return b.orm
+	orm, _ := b.resolver.Master(context.Background())
+	return orm
 }
 
+// SXorm 不带上下文获取只读库，resolver需要上下文(如按租户路由)时返回nil
 func (b *BaseRepository) SXorm() *xorm.Engine {
-	return b.sorm[rand.Intn(len(b.sorm))]
+	orm, _ := b.resolver.Replica(context.Background())
+	return orm
 }
 
 func (b *BaseRepository) Save(bean interface{}) (int64, error) {
-	return b.orm.Insert(bean)
+	if b.tenant {
+		return 0, ErrNoTenant
+	}
+	if err := assignId(bean); err != nil {
+		return 0, err
+	}
+	orm, err := b.resolver.Master(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	return orm.Insert(bean)
+}
+
+func (b *BaseRepository) SaveContext(ctx context.Context, bean interface{}) (n int64, err error) {
+	ctx, end := b.trace(ctx, "SaveContext")
+	defer func() { end(RowsAffected, n, err) }()
+	if err = b.markTenant(ctx, bean); err != nil {
+		return
+	}
+	if err = assignId(bean); err != nil {
+		return
+	}
+	orm, err := b.resolver.Master(ctx)
+	if err != nil {
+		return
+	}
+	return orm.Context(ctx).Insert(bean)
 }
 
 func (b *BaseRepository) Update(id int64, bean interface{}, cols ...string) (int64, error) {
-	s := b.orm.ID(id)
+	if b.tenant {
+		return 0, ErrNoTenant
+	}
+	orm, err := b.resolver.Master(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	s := orm.ID(id)
 	if len(cols) > 0 {
 		s.Cols(cols...)
 	}
 	return s.Update(bean)
 }
 
-func (b *BaseRepository) ReadById(ctx context.Context, id int64, bean interface{}, cols ...string) (bool, error) {
-	s := b.sorm[rand.Intn(len(b.sorm))].Context(ctx).ID(id)
+func (b *BaseRepository) UpdateContext(ctx context.Context, id int64, bean interface{}, cols ...string) (n int64, err error) {
+	ctx, end := b.trace(ctx, "UpdateContext")
+	defer func() { end(RowsAffected, n, err) }()
+	orm, err := b.resolver.Master(ctx)
+	if err != nil {
+		return
+	}
+	return b.txUpdate(ctx, orm.Context(ctx), id, bean, cols...)
+}
+
+// Delete 删除id对应的数据，bean为实体的指针，其中的非零字段也会作为删除条件
+func (b *BaseRepository) Delete(ctx context.Context, id int64, bean interface{}) (n int64, err error) {
+	ctx, end := b.trace(ctx, "Delete")
+	defer func() { end(RowsAffected, n, err) }()
+	if err = b.markTenant(ctx, bean); err != nil {
+		return
+	}
+	orm, err := b.resolver.Master(ctx)
+	if err != nil {
+		return
+	}
+	cond, err := b.tenantCond(ctx, orm, bean)
+	if err != nil {
+		return
+	}
+	return orm.Context(ctx).ID(id).And(cond).Delete(bean)
+}
+
+func (b *BaseRepository) ReadById(ctx context.Context, id int64, bean interface{}, cols ...string) (has bool, err error) {
+	ctx, end := b.trace(ctx, "ReadById")
+	defer func() {
+		var n int64
+		if has {
+			n = 1
+		}
+		end(RowsReturned, n, err)
+	}()
+	orm, err := b.resolver.Replica(ctx)
+	if err != nil {
+		return
+	}
+	cond, err := b.tenantCond(ctx, orm, bean)
+	if err != nil {
+		return
+	}
+	s := orm.Context(ctx).ID(id).And(cond)
 	if len(cols) > 0 {
 		s.Cols(cols...)
 	}
@@ -59,14 +164,27 @@ func (b *BaseRepository) ReadById(ctx context.Context, id int64, bean interface{
 }
 
 func (b *BaseRepository) Query(ctx context.Context, cq common.Query, list interface{}, count interface{}, cols ...string) (page *common.Pagination, err error) {
-	query := search.NewQuery(cq)
-	session := b.sorm[rand.Intn(len(b.sorm))].Context(ctx)
-	query.MarkOrmFiltered(b.column, session)
-	order := query.MarkOrder(b.column)
+	return b.Search(ctx, search.NewQuery(cq), list, count, cols...)
+}
+
+// Search 与Query相同，但支持search.Query中嵌套的AND/OR/NOT过滤分组
+func (b *BaseRepository) Search(ctx context.Context, query search.Query, list interface{}, count interface{}, cols ...string) (page *common.Pagination, err error) {
+	ctx, end := b.trace(ctx, "Search")
+	defer func() { end(RowsReturned, sliceLen(list), err) }()
+	orm, err := b.resolver.Replica(ctx)
+	if err != nil {
+		return
+	}
+	session := orm.Context(ctx)
+	column, err := b.filtered(ctx, query, session, list)
+	if err != nil {
+		return
+	}
+	order := query.MarkOrder(column)
 	page = query.MarkPage()
 	limit, offset := page.Limit()
 	if order != nil {
-		session.OrderBy(order.ToString())
+		session.OrderBy(order.ToSql(string(orm.Dialect().URI().DBType)))
 	}
 	session.Limit(limit, offset)
 	if len(cols) > 0 {
@@ -79,22 +197,127 @@ func (b *BaseRepository) Query(ctx context.Context, cq common.Query, list interf
 	return
 }
 
+// Aggregate 使用与Query相同的过滤条件对bean对应的表进行分组统计，结果写入rows(结构体切片的指针)，
+// 结构体字段按照列名映射规则与GroupBy和Aggregate的As对应，如As为total_amount时对应字段TotalAmount
+func (b *BaseRepository) Aggregate(ctx context.Context, cq common.Query, bean interface{}, groupBy []search.GroupBy, aggregates []search.Aggregate, rows interface{}) (err error) {
+	ctx, end := b.trace(ctx, "Aggregate")
+	defer func() { end(RowsReturned, sliceLen(rows), err) }()
+	query := search.NewQuery(cq)
+	orm, err := b.resolver.Replica(ctx)
+	if err != nil {
+		return
+	}
+	dialect := string(orm.Dialect().URI().DBType)
+	session := orm.Context(ctx).Table(bean)
+	column, err := b.filtered(ctx, query, session, bean, search.AggregateIds(groupBy, aggregates)...)
+	if err != nil {
+		return
+	}
+	selects, groups, order, err := query.MarkAggregate(column, dialect, groupBy, aggregates)
+	if err != nil {
+		return
+	}
+	session.Select(strings.Join(selects, ","))
+	if len(groups) > 0 {
+		session.GroupBy(strings.Join(groups, ",")).OrderBy(order.ToSql(dialect))
+	}
+	return session.Find(rows)
+}
+
+/**
+ * 添加租户条件、query中的过滤条件以及过滤、排序和ids使用到的关联表，bean为主表的实体或实体的切片，
+ * 返回排序和聚合使用的字段映射，有关联表时主表字段使用表名限定(见search.Query.Qualified)。
+ */
+func (b *BaseRepository) filtered(ctx context.Context, query search.Query, session *xorm.Session, bean interface{}, ids ...string) (map[string]search.Filter, error) {
+	orm := session.Engine()
+	cond, err := b.tenantCond(ctx, orm, bean)
+	if err != nil {
+		return nil, err
+	}
+	session.And(cond)
+	column := query.Qualified(b.column, orm.Quote(orm.TableName(elemBean(bean), true)), ids...)
+	query.MarkOrmJoined(column, session, ids...)
+	return column, query.MarkOrmFiltered(column, session)
+}
+
+// Session 获取主库的session，resolver无法获取主库时panic
 func (b *BaseRepository) Session(ctx context.Context) *xorm.Session {
-	return b.orm.Context(ctx)
+	orm, err := b.resolver.Master(ctx)
+	if err != nil {
+		panic(fmt.Sprintf("获取主库出错:%+v", err))
+	}
+	return orm.Context(ctx)
 }
 
+// SSession 获取只读库的session，resolver无法获取只读库时panic
 func (b *BaseRepository) SSession(ctx context.Context) *xorm.Session {
-	return b.sorm[rand.Intn(len(b.sorm))].Context(ctx)
+	orm, err := b.resolver.Replica(ctx)
+	if err != nil {
+		panic(fmt.Sprintf("获取只读库出错:%+v", err))
+	}
+	return orm.Context(ctx)
 }
 
 func (b *BaseRepository) TxSave(tx *xorm.Session, bean interface{}) (int64, error) {
+	if b.tenant {
+		return 0, ErrNoTenant
+	}
+	if err := assignId(bean); err != nil {
+		return 0, err
+	}
+	return tx.Insert(bean)
+}
+
+func (b *BaseRepository) TxSaveContext(ctx context.Context, tx *xorm.Session, bean interface{}) (n int64, err error) {
+	ctx, end := b.trace(ctx, "TxSaveContext")
+	defer func() { end(RowsAffected, n, err) }()
+	if err = b.markTenant(ctx, bean); err != nil {
+		return
+	}
+	if err = assignId(bean); err != nil {
+		return
+	}
 	return tx.Insert(bean)
 }
 
 func (b *BaseRepository) TxUpdate(tx *xorm.Session, id int64, bean interface{}, cols ...string) (int64, error) {
+	if b.tenant {
+		return 0, ErrNoTenant
+	}
 	tx = tx.ID(id)
 	if len(cols) > 0 {
 		tx.Cols(cols...)
 	}
 	return tx.Update(bean)
 }
+
+// TxUpdateContext 与TxUpdate相同，租户模式下只更新上下文中租户的数据，且不会修改数据的租户
+func (b *BaseRepository) TxUpdateContext(ctx context.Context, tx *xorm.Session, id int64, bean interface{}, cols ...string) (n int64, err error) {
+	ctx, end := b.trace(ctx, "TxUpdateContext")
+	defer func() { end(RowsAffected, n, err) }()
+	return b.txUpdate(ctx, tx, id, bean, cols...)
+}
+
+func (b *BaseRepository) txUpdate(ctx context.Context, tx *xorm.Session, id int64, bean interface{}, cols ...string) (int64, error) {
+	cond, err := b.tenantCond(ctx, tx.Engine(), bean)
+	if err != nil {
+		return 0, err
+	}
+	if err = b.markTenant(ctx, bean); err != nil {
+		return 0, err
+	}
+	tx = tx.ID(id).And(cond)
+	if len(cols) > 0 {
+		tx.Cols(cols...)
+	}
+	return tx.Update(bean)
+}
+
+// sliceLen list为切片或切片的指针时返回其长度，否则返回0
+func sliceLen(list interface{}) int64 {
+	v := reflect.Indirect(reflect.ValueOf(list))
+	if v.Kind() != reflect.Slice {
+		return 0
+	}
+	return int64(v.Len())
+}
@@ -1,15 +1,17 @@
 package base
 
 import (
+	"fmt"
+	"reflect"
 	"time"
 )
 
 type Entity struct {
-	Id             int64 `xorm:"pk autoincr bigint"`
-	CreateBy       int64 `xorm:"bigint not null"`
-	CreateTime     int64 `xorm:"bigint not null"`
-	LastModifyBy   int64 `xorm:"bigint null"`
-	LastModifyTime int64 `xorm:"bigint null"`
+	Id             int64 `xorm:"pk autoincr bigint" search:"id,op=in,type=int,sortable"`
+	CreateBy       int64 `xorm:"bigint not null" search:"createBy,type=int"`
+	CreateTime     int64 `xorm:"bigint not null" search:"createTime,op=between,type=unix,sortable"`
+	LastModifyBy   int64 `xorm:"bigint null" search:"lastModifyBy,type=int"`
+	LastModifyTime int64 `xorm:"bigint null" search:"lastModifyTime,op=between,type=unix,sortable"`
 }
 
 func (t *Entity) BeforeInsert() {
@@ -23,3 +25,62 @@ func (t *Entity) BeforeUpdate() {
 		t.LastModifyTime = time.Now().Unix()
 	}
 }
+
+// IdGenerator 分布式ID生成器，如idgen.Snowflake、idgen.Segment
+type IdGenerator interface {
+	NextId() (int64, error)
+}
+
+var idGenerator IdGenerator
+
+// SetIdGenerator 设置IdEntity插入时使用的ID生成器，应在启动时设置一次
+func SetIdGenerator(generator IdGenerator) {
+	idGenerator = generator
+}
+
+// IdEntity 与Entity相同，但Id不使用数据库自增，而是在插入前通过IdGenerator生成，适用于分片或需要在插入前获取ID的场景。
+// BaseRepository和ShardRepository的Save等方法生成失败时返回错误，直接使用xorm插入时由BeforeInsert生成，失败时Id保持为0
+type IdEntity struct {
+	Id             int64 `xorm:"pk bigint" search:"id,op=in,type=int,sortable"`
+	CreateBy       int64 `xorm:"bigint not null" search:"createBy,type=int"`
+	CreateTime     int64 `xorm:"bigint not null" search:"createTime,op=between,type=unix,sortable"`
+	LastModifyBy   int64 `xorm:"bigint null" search:"lastModifyBy,type=int"`
+	LastModifyTime int64 `xorm:"bigint null" search:"lastModifyTime,op=between,type=unix,sortable"`
+}
+
+// BeforeInsert 设置了ID生成器且Id为0时生成ID，xorm无法返回错误，需要处理生成失败时先调用NextId
+func (t *IdEntity) BeforeInsert() {
+	if t.Id == 0 && idGenerator != nil {
+		t.Id, _ = idGenerator.NextId()
+	}
+	if t.CreateTime == 0 {
+		t.CreateTime = time.Now().Unix()
+	}
+}
+
+func (t *IdEntity) BeforeUpdate() {
+	if t.LastModifyTime == 0 {
+		t.LastModifyTime = time.Now().Unix()
+	}
+}
+
+// NextId 插入前为实体生成ID，如需要在插入前使用ID作为分片键
+func (t *IdEntity) NextId() (err error) {
+	if idGenerator == nil {
+		return fmt.Errorf("未设置ID生成器，请先调用base.SetIdGenerator")
+	}
+	t.Id, err = idGenerator.NextId()
+	return
+}
+
+// assignId 实体实现了NextId(如IdEntity)且Id为0时生成ID，生成失败时返回错误
+func assignId(bean interface{}) error {
+	e, ok := bean.(interface{ NextId() error })
+	if !ok {
+		return nil
+	}
+	if v := reflect.Indirect(reflect.ValueOf(bean)).FieldByName("Id"); v.IsValid() && v.IsZero() {
+		return e.NextId()
+	}
+	return nil
+}
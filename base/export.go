@@ -0,0 +1,209 @@
+package base
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aluka-7/common"
+)
+
+// ExportFormat 导出文件的格式
+type ExportFormat int
+
+const (
+	CSV      ExportFormat = iota // 逗号分隔，第一行为列的显示名称
+	ExcelCSV                     // 同CSV，但以UTF-8 BOM开头，Excel可以正确识别中文，以=、+、-、@开头的非数值单元格前加'，避免被当作公式执行
+	NDJSON                       // 每行一个JSON对象，key为列的显示名称，顺序与列的顺序一致
+)
+
+// Formatter 将字段的值转换为导出的字符串
+type Formatter func(value interface{}) string
+
+// ExportColumn 导出的列，Field为结构体的字段名(可以直接使用嵌入结构体的字段，如CreateTime)，
+// Title为显示名称，Format为空时CSV使用fmt.Sprint，NDJSON使用原始值
+type ExportColumn struct {
+	Field  string
+	Title  string
+	Format Formatter
+}
+
+// UnixTime 将base.Entity中秒级的时间戳按照layout格式化，0和nil表示未设置，输出为空字符串，
+// 指针会取其指向的值，不是整数的值使用fmt.Sprint输出
+func UnixTime(layout string) Formatter {
+	return func(value interface{}) string {
+		v := reflect.ValueOf(value)
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return ""
+			}
+			v = v.Elem()
+		}
+		var sec int64
+		switch v.Kind() {
+		case reflect.Invalid:
+			return ""
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			sec = v.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			sec = int64(v.Uint())
+		default:
+			return fmt.Sprint(v.Interface())
+		}
+		if sec == 0 {
+			return ""
+		}
+		return time.Unix(sec, 0).Format(layout)
+	}
+}
+
+// DateTime 按照"2006-01-02 15:04:05"格式化秒级的时间戳
+var DateTime = UnixTime("2006-01-02 15:04:05")
+
+/**
+ * 使用cq中的过滤条件和排序从只读库中逐行读取bean对应的表，并按照format写入w，
+ * 导出过程中不会把全部结果读入内存，ctx被取消或写入失败时停止导出并返回错误。
+ */
+func Export(ctx context.Context, repo IExtendedRepository, cq common.Query, bean interface{}, columns []ExportColumn, format ExportFormat, w io.Writer) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("未指定导出的列")
+	}
+	t := reflect.Indirect(reflect.ValueOf(bean)).Type()
+	for _, c := range columns {
+		if f, ok := t.FieldByName(c.Field); !ok || len(f.Index) == 0 {
+			return fmt.Errorf("%s中不存在字段[%s]", t.Name(), c.Field)
+		}
+	}
+	bw := bufio.NewWriter(w)
+	var writer rowWriter
+	switch format {
+	case CSV, ExcelCSV:
+		if format == ExcelCSV {
+			if _, err := bw.WriteString("\xEF\xBB\xBF"); err != nil {
+				return err
+			}
+		}
+		writer = &csvWriter{w: csv.NewWriter(bw), excel: format == ExcelCSV}
+	case NDJSON:
+		writer = &jsonWriter{w: bw}
+	default:
+		return fmt.Errorf("不支持的导出格式[%d]", format)
+	}
+	if err := writer.header(columns); err != nil {
+		return err
+	}
+	err := repo.Iterate(ctx, cq, bean, func(row interface{}) error {
+		v := reflect.Indirect(reflect.ValueOf(row))
+		return writer.row(columns, func(c ExportColumn) interface{} {
+			return v.FieldByName(c.Field).Interface()
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if err = writer.flush(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+type rowWriter interface {
+	header(columns []ExportColumn) error
+	row(columns []ExportColumn, value func(c ExportColumn) interface{}) error
+	flush() error
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	excel  bool
+	record []string
+}
+
+func (c *csvWriter) header(columns []ExportColumn) error {
+	c.record = make([]string, len(columns))
+	for i, v := range columns {
+		c.record[i] = v.Title
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) row(columns []ExportColumn, value func(c ExportColumn) interface{}) error {
+	for i, v := range columns {
+		if v.Format != nil {
+			c.record[i] = v.Format(value(v))
+		} else {
+			c.record[i] = fmt.Sprint(value(v))
+		}
+		if c.excel {
+			c.record[i] = escapeFormula(c.record[i])
+		}
+	}
+	return c.w.Write(c.record)
+}
+
+// escapeFormula 以公式字符开头的单元格前加'，Excel将其作为文本显示，负数等数值保持不变
+func escapeFormula(s string) string {
+	if len(s) == 0 || !strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return s
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return s
+	}
+	return "'" + s
+}
+
+func (c *csvWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonWriter struct {
+	w      *bufio.Writer
+	titles [][]byte
+}
+
+func (j *jsonWriter) header(columns []ExportColumn) error {
+	j.titles = make([][]byte, len(columns))
+	for i, v := range columns {
+		title, err := json.Marshal(v.Title)
+		if err != nil {
+			return err
+		}
+		j.titles[i] = title
+	}
+	return nil
+}
+
+func (j *jsonWriter) row(columns []ExportColumn, value func(c ExportColumn) interface{}) error {
+	j.w.WriteByte('{')
+	for i, v := range columns {
+		if i > 0 {
+			j.w.WriteByte(',')
+		}
+		j.w.Write(j.titles[i])
+		j.w.WriteByte(':')
+		var val interface{} = value(v)
+		if v.Format != nil {
+			val = v.Format(val)
+		}
+		data, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		j.w.Write(data)
+	}
+	j.w.WriteByte('}')
+	_, err := j.w.Write([]byte{'\n'})
+	return err
+}
+
+func (j *jsonWriter) flush() error {
+	return nil
+}
@@ -0,0 +1,92 @@
+package base_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aluka-7/common"
+	"github.com/aluka-7/datasource/base"
+)
+
+func TestExport(t *testing.T) {
+	repo := newStreamRepository(t)
+	cq := common.Query{}
+	cq.SetFiltered("name", "b")
+	cq.SetSorted("id", false)
+	columns := []base.ExportColumn{
+		{Field: "Id", Title: "编号"},
+		{Field: "Name", Title: "名称"},
+		{Field: "CreateTime", Title: "创建时间", Format: base.UnixTime("2006-01-02")},
+	}
+	today := time.Now().Format("2006-01-02")
+
+	var buf bytes.Buffer
+	if err := base.Export(context.Background(), &repo, cq, new(record), columns, base.ExcelCSV, &buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || lines[0] != "\xEF\xBB\xBF编号,名称,创建时间" || lines[1] != "2,b,"+today {
+		t.Errorf("unexpected csv %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := base.Export(context.Background(), &repo, cq, new(record), columns, base.NDJSON, &buf); err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || lines[0] != `{"编号":2,"名称":"b","创建时间":"`+today+`"}` {
+		t.Errorf("unexpected ndjson %q", buf.String())
+	}
+
+	// ExcelCSV中以公式字符开头的单元格前加'，数值不变，CSV保持原值
+	formula := []base.ExportColumn{
+		{Field: "Name", Title: "公式", Format: func(interface{}) string { return "=HYPERLINK(\"http://x\")" }},
+		{Field: "Name", Title: "负数", Format: func(interface{}) string { return "-1.5" }},
+		{Field: "Name", Title: "账号", Format: func(interface{}) string { return "@admin" }},
+	}
+	buf.Reset()
+	if err := base.Export(context.Background(), &repo, cq, new(record), formula, base.ExcelCSV, &buf); err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || lines[1] != `"'=HYPERLINK(""http://x"")",-1.5,'@admin` {
+		t.Errorf("unexpected excel csv %q", buf.String())
+	}
+	buf.Reset()
+	if err := base.Export(context.Background(), &repo, cq, new(record), formula, base.CSV, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines = strings.Split(strings.TrimSpace(buf.String()), "\n"); lines[1] != `"=HYPERLINK(""http://x"")",-1.5,@admin` {
+		t.Errorf("unexpected csv %q", buf.String())
+	}
+
+	if err := base.Export(context.Background(), &repo, cq, new(record), []base.ExportColumn{{Field: "Missing"}}, base.CSV, &buf); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestUnixTime(t *testing.T) {
+	format := base.UnixTime("2006-01-02")
+	sec := time.Date(2021, 6, 1, 10, 0, 0, 0, time.Local).Unix()
+	usec := uint64(sec)
+	var null *int64
+	for _, c := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{sec, "2021-06-01"},
+		{int32(0), ""},
+		{usec, "2021-06-01"},
+		{&sec, "2021-06-01"},
+		{null, ""},
+		{nil, ""},
+		{"2021-06-01", "2021-06-01"},
+	} {
+		if actual := format(c.value); actual != c.expected {
+			t.Errorf("format %#v: expected %q, got %q", c.value, c.expected, actual)
+		}
+	}
+}
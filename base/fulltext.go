@@ -0,0 +1,88 @@
+package base
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aluka-7/datasource/search"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+/**
+ * 为实体的指定列创建全文索引，返回search.MATCH操作符在字段映射中使用的字段名。
+ * mysql创建FULLTEXT索引；sqlite3创建以原表为content的FTS5虚拟表，并通过触发器在插入、更新、删除时保持同步，
+ * 首次创建时会导入原表中已有的数据(sqlite3需要使用fts5标签编译go-sqlite3)。
+ *
+ * @param columns 数据库列名，如email、name
+ */
+func SyncFullText(orm *xorm.Engine, bean interface{}, columns ...string) (string, error) {
+	if len(columns) == 0 {
+		return "", fmt.Errorf("未指定全文索引的列")
+	}
+	table, err := orm.TableInfo(bean)
+	if err != nil {
+		return "", err
+	}
+	for _, v := range columns {
+		if table.GetColumn(v) == nil {
+			return "", fmt.Errorf("表[%s]中不存在列[%s]", table.Name, v)
+		}
+	}
+	tableName := orm.TableName(bean)
+	switch orm.Dialect().URI().DBType {
+	case schemas.MYSQL:
+		err = syncMysqlFullText(orm, tableName, columns)
+	case schemas.SQLITE:
+		err = syncSqliteFullText(orm, tableName, columns)
+	default:
+		return "", fmt.Errorf("数据库[%s]不支持全文索引", orm.Dialect().URI().DBType)
+	}
+	if err != nil {
+		return "", err
+	}
+	return search.FullTextField(tableName, columns...), nil
+}
+
+func syncMysqlFullText(orm *xorm.Engine, table string, columns []string) error {
+	index := "FT_" + table + "_" + strings.Join(columns, "_")
+	exist, err := orm.SQL("SELECT 1 FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?", table, index).Exist()
+	if err != nil || exist {
+		return err
+	}
+	_, err = orm.Exec(fmt.Sprintf("ALTER TABLE %s ADD FULLTEXT INDEX %s (%s)", orm.Quote(table), orm.Quote(index), strings.Join(columns, ",")))
+	return err
+}
+
+func syncSqliteFullText(orm *xorm.Engine, table string, columns []string) error {
+	fts := search.FullTextTable(table)
+	exist, err := orm.IsTableExist(fts)
+	if err != nil {
+		return err
+	}
+	cols := strings.Join(columns, ",")
+	newCols := "new." + strings.Join(columns, ",new.")
+	oldCols := "old." + strings.Join(columns, ",old.")
+	id := search.FullTextRowId
+	sqls := []string{
+		fmt.Sprintf("CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts5(%s, content='%s', content_rowid='%s')", fts, cols, table, id),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_ai AFTER INSERT ON %s BEGIN INSERT INTO %s(rowid,%s) VALUES (new.%s,%s); END",
+			fts, table, fts, cols, id, newCols),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_ad AFTER DELETE ON %s BEGIN INSERT INTO %s(%s,rowid,%s) VALUES ('delete',old.%s,%s); END",
+			fts, table, fts, fts, cols, id, oldCols),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_au AFTER UPDATE ON %s BEGIN INSERT INTO %s(%s,rowid,%s) VALUES ('delete',old.%s,%s); INSERT INTO %s(rowid,%s) VALUES (new.%s,%s); END",
+			fts, table, fts, fts, cols, id, oldCols, fts, cols, id, newCols),
+	}
+	if !exist {
+		sqls = append(sqls, fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild')", fts, fts))
+	}
+	_, err = orm.Transaction(func(session *xorm.Session) (interface{}, error) {
+		for _, v := range sqls {
+			if _, err := session.Exec(v); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
@@ -0,0 +1,68 @@
+//go:build sqlite_fts5 || fts5
+// +build sqlite_fts5 fts5
+
+package base_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/aluka-7/common"
+	"github.com/aluka-7/datasource/base"
+	"github.com/aluka-7/datasource/search"
+	_ "github.com/mattn/go-sqlite3"
+	"xorm.io/xorm"
+	"xorm.io/xorm/names"
+)
+
+type article struct {
+	base.Entity `xorm:"extends"`
+	Title       string `xorm:"varchar(100)"`
+	Body        string `xorm:"text"`
+}
+
+func TestSyncFullText(t *testing.T) {
+	orm, err := xorm.NewEngine("sqlite3", filepath.Join(t.TempDir(), "fts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orm.Close()
+	orm.SetTableMapper(names.NewPrefixMapper(names.SnakeMapper{}, "os_1000_"))
+	if err = orm.Sync2(new(article)); err != nil {
+		t.Fatal(err)
+	}
+	// 创建全文索引前已有的数据需要被导入
+	if _, err = orm.Insert(&article{Title: "hello world", Body: "first article"}); err != nil {
+		t.Fatal(err)
+	}
+	field, err := base.SyncFullText(orm, new(article), "title", "body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = base.SyncFullText(orm, new(article), "title", "body"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = orm.Insert(&article{Title: "hello golang", Body: "second article"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = orm.ID(1).Cols("body").Update(&article{Body: "updated text"}); err != nil {
+		t.Fatal(err)
+	}
+	repo := base.NewBaseRepository(orm, []*xorm.Engine{orm}, map[string]search.Filter{
+		"q": {FieldName: field, Operator: search.MATCH},
+	})
+	tests := map[string]int{"hello": 2, "hello golang": 1, "article": 1, "updated": 1, "missing": 0}
+	for q, expected := range tests {
+		var list []article
+		query := common.Query{}
+		query.SetFiltered("q", q)
+		page, err := repo.Query(context.Background(), query, &list, new(article))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.TotalRecords != expected {
+			t.Errorf("%s: expected %d, got %d", q, expected, page.TotalRecords)
+		}
+	}
+}
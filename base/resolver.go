@@ -0,0 +1,35 @@
+package base
+
+import (
+	"context"
+	"math/rand"
+
+	"xorm.io/xorm"
+)
+
+// EngineResolver 根据上下文获取主库和只读库的引擎，如按照上下文中的租户路由到不同的数据库
+type EngineResolver interface {
+	Master(ctx context.Context) (*xorm.Engine, error)
+	Replica(ctx context.Context) (*xorm.Engine, error)
+}
+
+// StaticResolver 使用固定的主库和只读库，只读库随机选取，没有只读库时使用主库
+func StaticResolver(orm *xorm.Engine, sorm []*xorm.Engine) EngineResolver {
+	return staticResolver{orm: orm, sorm: sorm}
+}
+
+type staticResolver struct {
+	orm  *xorm.Engine
+	sorm []*xorm.Engine
+}
+
+func (s staticResolver) Master(context.Context) (*xorm.Engine, error) {
+	return s.orm, nil
+}
+
+func (s staticResolver) Replica(context.Context) (*xorm.Engine, error) {
+	if len(s.sorm) == 0 {
+		return s.orm, nil
+	}
+	return s.sorm[rand.Intn(len(s.sorm))], nil
+}
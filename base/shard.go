@@ -0,0 +1,444 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	gosort "sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aluka-7/common"
+	"github.com/aluka-7/datasource/search"
+	"github.com/aluka-7/datasource/sort"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrNoShardKey 上下文和实体中都没有分片键
+var ErrNoShardKey = errors.New("上下文和实体中都没有分片键，无法确定分片")
+
+// ShardFunc 根据分片键计算分片的序号，n为分片的数量，返回值应在[0,n)之间
+type ShardFunc func(key interface{}, n int) (int, error)
+
+// Modulo 整数的分片键按照对n取余分片，其他类型的分片键按照字符串的CRC32取余分片
+func Modulo() ShardFunc {
+	return func(key interface{}, n int) (int, error) {
+		if k, ok := shardInt(key); ok {
+			if k < 0 {
+				k = -k
+			}
+			return int(k % int64(n)), nil
+		}
+		return int(crc32.ChecksumIEEE([]byte(fmt.Sprint(key))) % uint32(n)), nil
+	}
+}
+
+/**
+ * 整数的分片键按照范围分片，bounds为升序的n-1个分界值，分片i保存[bounds[i-1], bounds[i])之间的数据，
+ * 如Range(1000000, 2000000)表示小于1000000的在分片0，大于等于2000000的在分片2。
+ */
+func Range(bounds ...int64) ShardFunc {
+	return func(key interface{}, n int) (int, error) {
+		if len(bounds) != n-1 {
+			return 0, fmt.Errorf("范围分片的分界值数量[%d]与分片数量[%d]不匹配", len(bounds), n)
+		}
+		k, ok := shardInt(key)
+		if !ok {
+			return 0, fmt.Errorf("范围分片的分片键[%v]不是整数", key)
+		}
+		return gosort.Search(len(bounds), func(i int) bool { return k < bounds[i] }), nil
+	}
+}
+
+/**
+ * 一致性哈希分片，每个分片在哈希环上有replicas个虚拟节点，增加分片时只有少量数据需要迁移，
+ * 分片键按照字符串的CRC32计算在环上的位置。
+ */
+func ConsistentHash(replicas int) ShardFunc {
+	if replicas <= 0 {
+		replicas = 100
+	}
+	var lock sync.Mutex
+	rings := make(map[int][]ringNode)
+	return func(key interface{}, n int) (int, error) {
+		lock.Lock()
+		ring, ok := rings[n]
+		if !ok {
+			ring = make([]ringNode, 0, n*replicas)
+			for i := 0; i < n; i++ {
+				for j := 0; j < replicas; j++ {
+					ring = append(ring, ringNode{hash: crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + "#" + strconv.Itoa(j))), shard: i})
+				}
+			}
+			gosort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+			rings[n] = ring
+		}
+		lock.Unlock()
+		h := crc32.ChecksumIEEE([]byte(fmt.Sprint(key)))
+		i := gosort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+		if i == len(ring) {
+			i = 0
+		}
+		return ring[i].shard, nil
+	}
+}
+
+type ringNode struct {
+	hash  uint32
+	shard int
+}
+
+func shardInt(key interface{}) (int64, bool) {
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), true
+	}
+	return 0, false
+}
+
+type shardKey struct{}
+
+// WithShardKey 返回携带分片键的上下文，上下文中的分片键优先于实体中的分片键
+func WithShardKey(ctx context.Context, key interface{}) context.Context {
+	return context.WithValue(ctx, shardKey{}, key)
+}
+
+// ShardKeyFrom 获取上下文中的分片键
+func ShardKeyFrom(ctx context.Context) (interface{}, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	key := ctx.Value(shardKey{})
+	return key, key != nil
+}
+
+/**
+ * 创建分片的Repository，shards为各个物理分片的引擎，field为实体中分片键的字段名(如Id、UserId)，
+ * 分片键优先从上下文中获取(见WithShardKey)，其次从实体的field字段获取，field为Id时也会使用ReadById等方法的id。
+ * 无法确定分片时ReadById会依次查询所有分片，Query会查询所有分片后合并排序和分页，
+ * Save、Update、Delete返回ErrNoShardKey(各分片的自增id可能相同，不能在所有分片上按id写入)。
+ */
+func NewShardRepository(shards []EngineResolver, column map[string]search.Filter, field string, fn ShardFunc) ShardRepository {
+	repos := make([]BaseRepository, len(shards))
+	for i, v := range shards {
+		repos[i] = NewResolverRepository(v, column)
+	}
+	return ShardRepository{shards: repos, column: column, field: field, fn: fn}
+}
+
+type ShardRepository struct {
+	shards []BaseRepository
+	column map[string]search.Filter
+	field  string
+	fn     ShardFunc
+}
+
+// Traced 所有分片的Repository使用tp记录链路追踪，见BaseRepository.Traced
+func (s *ShardRepository) Traced(tp trace.TracerProvider) {
+	for i := range s.shards {
+		s.shards[i].Traced(tp)
+	}
+}
+
+// Shards 所有分片的Repository，用于事务、统计等需要直接访问分片的场景
+func (s *ShardRepository) Shards() []BaseRepository {
+	return s.shards
+}
+
+// Shard 获取分片键对应的分片
+func (s *ShardRepository) Shard(key interface{}) (*BaseRepository, error) {
+	if len(s.shards) == 0 {
+		return nil, fmt.Errorf("没有可用的分片")
+	}
+	i, err := s.fn(key, len(s.shards))
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= len(s.shards) {
+		return nil, fmt.Errorf("分片键[%v]的分片序号[%d]超出范围", key, i)
+	}
+	return &s.shards[i], nil
+}
+
+// route 按照上下文、id(field为Id时)和实体中的分片键获取分片，都没有时返回nil
+func (s *ShardRepository) route(ctx context.Context, id int64, bean interface{}) (*BaseRepository, error) {
+	if key, ok := ShardKeyFrom(ctx); ok {
+		return s.Shard(key)
+	}
+	if s.field == "Id" && id != 0 {
+		return s.Shard(id)
+	}
+	if bean != nil {
+		if v := reflect.Indirect(reflect.ValueOf(bean)).FieldByName(s.field); v.IsValid() && !v.IsZero() {
+			return s.Shard(v.Interface())
+		}
+	}
+	return nil, nil
+}
+
+func (s *ShardRepository) Save(bean interface{}) (int64, error) {
+	return s.SaveContext(context.Background(), bean)
+}
+
+// SaveContext 分片键为Id且实体是IdEntity时，会在确定分片前生成ID
+func (s *ShardRepository) SaveContext(ctx context.Context, bean interface{}) (int64, error) {
+	if s.field == "Id" {
+		if err := assignId(bean); err != nil {
+			return 0, err
+		}
+	}
+	shard, err := s.writeShard(ctx, 0, bean)
+	if err != nil {
+		return 0, err
+	}
+	return shard.SaveContext(ctx, bean)
+}
+
+func (s *ShardRepository) ReadById(ctx context.Context, id int64, bean interface{}, cols ...string) (bool, error) {
+	shard, err := s.route(ctx, id, nil)
+	if err != nil {
+		return false, err
+	}
+	if shard != nil {
+		return shard.ReadById(ctx, id, bean, cols...)
+	}
+	for i := range s.shards {
+		if has, err := s.shards[i].ReadById(ctx, id, bean, cols...); err != nil || has {
+			return has, err
+		}
+	}
+	return false, nil
+}
+
+func (s *ShardRepository) Update(id int64, bean interface{}, cols ...string) (int64, error) {
+	return s.UpdateContext(context.Background(), id, bean, cols...)
+}
+
+func (s *ShardRepository) UpdateContext(ctx context.Context, id int64, bean interface{}, cols ...string) (int64, error) {
+	shard, err := s.writeShard(ctx, id, bean)
+	if err != nil {
+		return 0, err
+	}
+	return shard.UpdateContext(ctx, id, bean, cols...)
+}
+
+func (s *ShardRepository) Delete(ctx context.Context, id int64, bean interface{}) (int64, error) {
+	shard, err := s.writeShard(ctx, id, bean)
+	if err != nil {
+		return 0, err
+	}
+	return shard.Delete(ctx, id, bean)
+}
+
+// writeShard 写操作的分片，无法确定分片时返回ErrNoShardKey
+func (s *ShardRepository) writeShard(ctx context.Context, id int64, bean interface{}) (*BaseRepository, error) {
+	shard, err := s.route(ctx, id, bean)
+	if err == nil && shard == nil {
+		err = ErrNoShardKey
+	}
+	return shard, err
+}
+
+func (s *ShardRepository) Query(ctx context.Context, cq common.Query, list interface{}, count interface{}, cols ...string) (*common.Pagination, error) {
+	return s.Search(ctx, search.NewQuery(cq), list, count, cols...)
+}
+
+/**
+ * 上下文中有分片键时只查询对应的分片，否则并发查询所有分片的前(页码*每页数量)条数据，
+ * 按照query的排序合并后再分页，总数为各分片总数之和。页码越大每个分片需要读取的数据越多，不适合深度翻页。
+ * 合并排序只支持主表的字段，不支持关联表的字段。
+ */
+func (s *ShardRepository) Search(ctx context.Context, query search.Query, list interface{}, count interface{}, cols ...string) (*common.Pagination, error) {
+	if key, ok := ShardKeyFrom(ctx); ok {
+		shard, err := s.Shard(key)
+		if err != nil {
+			return nil, err
+		}
+		return shard.Search(ctx, query, list, count, cols...)
+	}
+	if len(s.shards) == 0 {
+		return nil, fmt.Errorf("没有可用的分片")
+	}
+	page := query.MarkPage()
+	limit, offset := page.Limit()
+	sub := query
+	sub.Page, sub.PageSize = 1, int32(limit+offset)
+	listValue := reflect.ValueOf(list).Elem()
+	countType := reflect.Indirect(reflect.ValueOf(count)).Type()
+	results := make([]reflect.Value, len(s.shards))
+	totals := make([]int, len(s.shards))
+	errs := make([]error, len(s.shards))
+	var wg sync.WaitGroup
+	for i := range s.shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rows := reflect.New(listValue.Type())
+			p, err := s.shards[i].Search(ctx, sub, rows.Interface(), reflect.New(countType).Interface(), cols...)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			results[i], totals[i] = rows.Elem(), p.Total()
+		}(i)
+	}
+	wg.Wait()
+	total := 0
+	for i, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+		total += totals[i]
+	}
+	var compare func(a, b reflect.Value) int
+	if order := query.MarkOrder(s.column); order != nil && len(order.Orders()) > 0 {
+		var err error
+		if compare, err = s.comparator(ctx, listValue.Type().Elem(), order); err != nil {
+			return nil, err
+		}
+	}
+	merged := mergeRows(results, compare, offset+limit)
+	if offset < merged.Len() {
+		merged = merged.Slice(offset, merged.Len())
+	} else {
+		merged = merged.Slice(0, 0)
+	}
+	listValue.Set(merged)
+	page.SetTotalRecord(total)
+	return page, nil
+}
+
+// mergeRows 合并各分片已排好序的结果，最多返回max行，compare为nil时按分片的顺序拼接
+func mergeRows(results []reflect.Value, compare func(a, b reflect.Value) int, max int) reflect.Value {
+	merged := reflect.MakeSlice(results[0].Type(), 0, max)
+	heads := make([]int, len(results))
+	for merged.Len() < max {
+		next := -1
+		for i, rows := range results {
+			if heads[i] >= rows.Len() {
+				continue
+			}
+			if next < 0 {
+				next = i
+				if compare == nil {
+					break
+				}
+			} else if compare(rows.Index(heads[i]), results[next].Index(heads[next])) < 0 {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		merged = reflect.Append(merged, results[next].Index(heads[next]))
+		heads[next]++
+	}
+	return merged
+}
+
+// comparator 按照order比较两行数据，列名通过实体的映射转换为结构体的字段
+func (s *ShardRepository) comparator(ctx context.Context, t reflect.Type, order *sort.Sort) (func(a, b reflect.Value) int, error) {
+	orm, err := s.shards[0].resolver.Replica(ctx)
+	if err != nil {
+		return nil, err
+	}
+	table, err := orm.TableInfo(reflect.New(t).Interface())
+	if err != nil {
+		return nil, err
+	}
+	orders := order.Orders()
+	fields := make([]string, len(orders))
+	for i, v := range orders {
+		col := table.GetColumn(v.Property())
+		if col == nil {
+			return nil, fmt.Errorf("分片查询不支持按[%s]排序，只能按主表的字段排序", v.Property())
+		}
+		fields[i] = col.FieldName
+	}
+	return func(a, b reflect.Value) int {
+		for i, v := range orders {
+			c := compareValue(fieldByPath(a, fields[i]), fieldByPath(b, fields[i]), v.NullOrder())
+			if c != 0 {
+				if v.Direction().Descending() {
+					return -c
+				}
+				return c
+			}
+		}
+		return 0
+	}, nil
+}
+
+// fieldByPath 获取字段，path中使用"."分隔嵌入的结构体，如Entity.Id
+func fieldByPath(v reflect.Value, path string) reflect.Value {
+	for _, name := range strings.Split(path, ".") {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.FieldByName(name)
+	}
+	return v
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// compareValue 比较两个字段的值，nil指针视为NULL，NullsNative时NULL最小
+func compareValue(a, b reflect.Value, nulls sort.NullHandling) int {
+	aNull, bNull := isNull(a), isNull(b)
+	if aNull || bNull {
+		if aNull && bNull {
+			return 0
+		}
+		c := 1
+		if aNull {
+			c = -1
+		}
+		if nulls == sort.NullsLast {
+			c = -c
+		}
+		return c
+	}
+	a, b = reflect.Indirect(a), reflect.Indirect(b)
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(a.Int() < b.Int(), a.Int() > b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compareOrdered(a.Uint() < b.Uint(), a.Uint() > b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return compareOrdered(a.Float() < b.Float(), a.Float() > b.Float())
+	case reflect.Bool:
+		return compareOrdered(!a.Bool() && b.Bool(), a.Bool() && !b.Bool())
+	case reflect.String:
+		return compareOrdered(a.String() < b.String(), a.String() > b.String())
+	}
+	if a.Type() == timeType {
+		at, bt := a.Interface().(time.Time), b.Interface().(time.Time)
+		return compareOrdered(at.Before(bt), at.After(bt))
+	}
+	as, bs := fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface())
+	return compareOrdered(as < bs, as > bs)
+}
+
+func isNull(v reflect.Value) bool {
+	return !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+func compareOrdered(less, greater bool) int {
+	if less {
+		return -1
+	}
+	if greater {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,214 @@
+package base_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aluka-7/common"
+	"github.com/aluka-7/datasource/base"
+	"github.com/aluka-7/datasource/search"
+	"xorm.io/xorm"
+)
+
+type member struct {
+	base.Entity `xorm:"extends"`
+	Name        string `search:"name,sortable"`
+}
+
+func TestShardFunc(t *testing.T) {
+	if i, _ := base.Modulo()(int64(7), 3); i != 1 {
+		t.Errorf("expected shard 1, got %d", i)
+	}
+	r := base.Range(100, 200)
+	for key, expected := range map[int64]int{0: 0, 99: 0, 100: 1, 199: 1, 200: 2, 1000: 2} {
+		if i, err := r(key, 3); err != nil || i != expected {
+			t.Errorf("key %d: expected shard %d, got %d %v", key, expected, i, err)
+		}
+	}
+	if _, err := r(1, 2); err == nil {
+		t.Error("expected error for mismatched bounds")
+	}
+	hash := base.ConsistentHash(50)
+	counts := make([]int, 4)
+	moved := 0
+	for k := 0; k < 1000; k++ {
+		i, _ := hash(k, 4)
+		counts[i]++
+		if j, _ := hash(k, 5); j != i && j != 4 {
+			moved++
+		}
+	}
+	for i, c := range counts {
+		if c == 0 {
+			t.Errorf("shard %d got no keys", i)
+		}
+	}
+	if moved > 0 {
+		t.Errorf("%d keys moved between existing shards after adding a shard", moved)
+	}
+}
+
+func TestShardRepository(t *testing.T) {
+	var shards []base.EngineResolver
+	for i := 0; i < 2; i++ {
+		orm, err := xorm.NewEngine("sqlite3", fmt.Sprintf("file:shard%d?mode=memory&cache=shared", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer orm.Close()
+		if err = orm.Sync2(new(member)); err != nil {
+			t.Fatal(err)
+		}
+		shards = append(shards, base.StaticResolver(orm, nil))
+	}
+	column := map[string]search.Filter{
+		"id":   {FieldName: "id", Operator: search.IN, Type: search.TypeInt},
+		"name": {FieldName: "name"},
+	}
+	repo := base.NewShardRepository(shards, column, "Id", base.Modulo())
+	ctx := context.Background()
+	if _, err := repo.Save(&member{Name: "x"}); err != base.ErrNoShardKey {
+		t.Errorf("expected ErrNoShardKey, got %v", err)
+	}
+	for i := int64(1); i <= 6; i++ {
+		if _, err := repo.Save(&member{Entity: base.Entity{Id: i}, Name: fmt.Sprintf("m%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var rows []member
+	if err := repo.Shards()[1].SXorm().Find(&rows); err != nil || len(rows) != 3 || rows[0].Id%2 != 1 {
+		t.Errorf("unexpected rows in shard 1: %+v %v", rows, err)
+	}
+
+	var m member
+	if has, err := repo.ReadById(ctx, 5, &m); err != nil || !has || m.Name != "m5" {
+		t.Errorf("unexpected read %+v %v %v", m, has, err)
+	}
+	if n, err := repo.Update(4, &member{Name: "u4"}); err != nil || n != 1 {
+		t.Errorf("unexpected update %d %v", n, err)
+	}
+
+	cq := common.Query{PageSize: 2, Page: 2}
+	cq.SetSorted("id", true)
+	var list []member
+	page, err := repo.Query(ctx, cq, &list, new(member))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total() != 6 || len(list) != 2 || list[0].Id != 4 || list[0].Name != "u4" || list[1].Id != 3 {
+		t.Errorf("unexpected page %d %+v", page.Total(), list)
+	}
+	cq = common.Query{PageSize: 10}
+	cq.SetFiltered("id", []int64{1, 2, 3})
+	if page, err = repo.Query(ctx, cq, &list, new(member)); err != nil || page.Total() != 3 || len(list) != 3 {
+		t.Errorf("unexpected filtered page %+v %v", list, err)
+	}
+	if page, err = repo.Query(base.WithShardKey(ctx, 2), common.Query{}, &list, new(member)); err != nil || page.Total() != 3 {
+		t.Errorf("unexpected shard page %+v %v", list, err)
+	}
+
+	if n, err := repo.Delete(ctx, 3, new(member)); err != nil || n != 1 {
+		t.Errorf("unexpected delete %d %v", n, err)
+	}
+
+	// 分片键不是Id时，各分片的自增id可能相同，无法确定分片的写操作不能在所有分片上执行
+	byName := base.NewShardRepository(shards, column, "Name", base.Modulo())
+	if _, err = byName.Update(4, new(member)); err != base.ErrNoShardKey {
+		t.Errorf("expected ErrNoShardKey, got %v", err)
+	}
+	if _, err = byName.Delete(ctx, 4, new(member)); err != base.ErrNoShardKey {
+		t.Errorf("expected ErrNoShardKey, got %v", err)
+	}
+	if has, err := byName.ReadById(ctx, 4, new(member)); err != nil || !has {
+		t.Errorf("unexpected read across shards %v %v", has, err)
+	}
+}
+
+type counter struct{ n int64 }
+
+func (c *counter) NextId() (int64, error) {
+	c.n++
+	return c.n, nil
+}
+
+type ticket struct {
+	base.IdEntity `xorm:"extends"`
+	Name          string
+}
+
+func TestShardIdEntity(t *testing.T) {
+	var shards []base.EngineResolver
+	for i := 0; i < 2; i++ {
+		orm, err := xorm.NewEngine("sqlite3", fmt.Sprintf("file:ticket%d?mode=memory&cache=shared", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer orm.Close()
+		if err = orm.Sync2(new(ticket)); err != nil {
+			t.Fatal(err)
+		}
+		shards = append(shards, base.StaticResolver(orm, nil))
+	}
+	base.SetIdGenerator(&counter{n: 100})
+	defer base.SetIdGenerator(nil)
+	repo := base.NewShardRepository(shards, nil, "Id", base.Modulo())
+	for i := 0; i < 4; i++ {
+		tk := &ticket{Name: "t"}
+		if _, err := repo.Save(tk); err != nil {
+			t.Fatal(err)
+		}
+		if tk.Id != int64(101+i) {
+			t.Errorf("expected id %d, got %d", 101+i, tk.Id)
+		}
+	}
+	var rows []ticket
+	if err := repo.Shards()[1].SXorm().Find(&rows); err != nil || len(rows) != 2 || rows[0].Id != 101 {
+		t.Errorf("unexpected rows in shard 1: %+v %v", rows, err)
+	}
+}
+
+type failingGenerator struct{}
+
+func (failingGenerator) NextId() (int64, error) {
+	return 0, errors.New("segment unavailable")
+}
+
+func TestIdEntity(t *testing.T) {
+	orm, err := xorm.NewEngine("sqlite3", "file:identity?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orm.Close()
+	if err = orm.Sync2(new(ticket)); err != nil {
+		t.Fatal(err)
+	}
+	repo := base.NewBaseRepository(orm, nil, nil)
+	ctx := context.Background()
+	if _, err = repo.SaveContext(ctx, &ticket{Name: "t"}); err == nil {
+		t.Error("expected error without id generator")
+	}
+	base.SetIdGenerator(failingGenerator{})
+	defer base.SetIdGenerator(nil)
+	if _, err = repo.SaveContext(ctx, &ticket{Name: "t"}); err == nil || err.Error() != "segment unavailable" {
+		t.Errorf("expected generator error, got %v", err)
+	}
+	// 已有ID时不调用生成器
+	if _, err = repo.SaveContext(ctx, &ticket{IdEntity: base.IdEntity{Id: 7}, Name: "t"}); err != nil {
+		t.Fatal(err)
+	}
+	base.SetIdGenerator(&counter{n: 10})
+	tk, tx := &ticket{Name: "t"}, orm.NewSession()
+	defer tx.Close()
+	if _, err = repo.TxSaveContext(ctx, tx, tk); err != nil || tk.Id != 11 {
+		t.Errorf("unexpected id %d %v", tk.Id, err)
+	}
+	// 直接使用xorm插入时由BeforeInsert生成ID
+	for i := int64(12); i <= 13; i++ {
+		tk = &ticket{Name: "t"}
+		if _, err = orm.Insert(tk); err != nil || tk.Id != i {
+			t.Errorf("unexpected id %d %v", tk.Id, err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/aluka-7/common"
+	"github.com/aluka-7/datasource/search"
+	"xorm.io/xorm"
+)
+
+/**
+ * 使用与Query相同的过滤条件和排序从只读库中逐行读取bean对应的表，不分页，每行调用一次fn，
+ * 传给fn的是与bean类型相同的新对象的指针，fn返回错误或ctx被取消时停止读取并返回该错误。
+ * 读取过程中只持有一个游标，适合导出等大数据量的场景。
+ */
+func (b *BaseRepository) Iterate(ctx context.Context, cq common.Query, bean interface{}, fn func(bean interface{}) error, cols ...string) error {
+	t := reflect.Indirect(reflect.ValueOf(bean)).Type()
+	return b.iterate(ctx, "Iterate", search.NewQuery(cq), t, cols, func(rows *xorm.Rows) error {
+		row := reflect.New(t).Interface()
+		if err := rows.Scan(row); err != nil {
+			return err
+		}
+		return fn(row)
+	}, nil)
+}
+
+/**
+ * 与Iterate相同，但每次将最多size行以切片([]T，T为bean的结构体类型)的形式传给fn，
+ * 切片的底层数组在多次调用之间会被复用，fn返回后不应再持有该切片，内存占用不超过size行。
+ */
+func (b *BaseRepository) IterateBatch(ctx context.Context, cq common.Query, bean interface{}, size int, fn func(batch interface{}) error, cols ...string) error {
+	if size <= 0 {
+		return fmt.Errorf("批量读取的行数必须大于0")
+	}
+	t := reflect.Indirect(reflect.ValueOf(bean)).Type()
+	batch := reflect.MakeSlice(reflect.SliceOf(t), 0, size)
+	flush := func() error {
+		if batch.Len() == 0 {
+			return nil
+		}
+		err := fn(batch.Interface())
+		batch = batch.Slice(0, 0)
+		return err
+	}
+	return b.iterate(ctx, "IterateBatch", search.NewQuery(cq), t, cols, func(rows *xorm.Rows) error {
+		batch = batch.Slice(0, batch.Len()+1)
+		row := batch.Index(batch.Len() - 1)
+		row.Set(reflect.Zero(t))
+		if err := rows.Scan(row.Addr().Interface()); err != nil {
+			return err
+		}
+		if batch.Len() == size {
+			return flush()
+		}
+		return nil
+	}, flush)
+}
+
+// iterate 逐行调用scan，全部读取完成后调用done(可以为nil)，method为链路追踪中的方法名
+func (b *BaseRepository) iterate(ctx context.Context, method string, query search.Query, t reflect.Type, cols []string, scan func(rows *xorm.Rows) error, done func() error) (err error) {
+	var n int64
+	ctx, end := b.trace(ctx, method)
+	defer func() { end(RowsReturned, n, err) }()
+	orm, err := b.resolver.Replica(ctx)
+	if err != nil {
+		return err
+	}
+	session := orm.NewSession().Context(ctx)
+	defer session.Close()
+	column, err := b.filtered(ctx, query, session, reflect.New(t).Interface())
+	if err != nil {
+		return err
+	}
+	if order := query.MarkOrder(column); order != nil {
+		session.OrderBy(order.ToSql(string(orm.Dialect().URI().DBType)))
+	}
+	if len(cols) > 0 {
+		session.Cols(cols...)
+	}
+	// Rows会将bean中的非零字段作为查询条件，因此使用新的对象
+	rows, err := session.Rows(reflect.New(t).Interface())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if err = scan(rows); err != nil {
+			return err
+		}
+		n++
+	}
+	// xorm在读取完所有行后将Err设置为sql.ErrNoRows
+	if err = rows.Err(); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if done != nil {
+		return done()
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package base_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aluka-7/common"
+	"github.com/aluka-7/datasource/base"
+	"github.com/aluka-7/datasource/search"
+	_ "github.com/mattn/go-sqlite3"
+	"xorm.io/xorm"
+)
+
+type record struct {
+	base.Entity `xorm:"extends"`
+	Name        string `search:"name"`
+}
+
+func newStreamRepository(t *testing.T) base.BaseRepository {
+	orm, err := xorm.NewEngine("sqlite3", "file:stream?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = orm.Close() })
+	if err = orm.Sync2(new(record)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = orm.Exec("DELETE FROM record"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		name := "a"
+		if i%2 == 1 {
+			name = "b"
+		}
+		if _, err = orm.Insert(&record{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	column, err := search.Columns(orm, new(record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base.NewBaseRepository(orm, []*xorm.Engine{orm}, column)
+}
+
+func TestIterate(t *testing.T) {
+	repo := newStreamRepository(t)
+	cq := common.Query{}
+	cq.SetFiltered("name", "a")
+	cq.SetSorted("id", true)
+	var ids []int64
+	err := repo.Iterate(context.Background(), cq, new(record), func(bean interface{}) error {
+		r := bean.(*record)
+		if r.Name != "a" {
+			t.Errorf("unexpected row %+v", r)
+		}
+		ids = append(ids, r.Id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 4 || ids[0] < ids[3] {
+		t.Errorf("unexpected ids %v", ids)
+	}
+
+	stop := errors.New("stop")
+	count := 0
+	err = repo.Iterate(context.Background(), common.Query{}, new(record), func(bean interface{}) error {
+		if count++; count == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || count != 2 {
+		t.Errorf("expected stop after 2 rows, got %v after %d", err, count)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = repo.Iterate(ctx, common.Query{}, new(record), func(interface{}) error { return nil }); err == nil {
+		t.Error("expected error for canceled context")
+	}
+}
+
+func TestIterateBatch(t *testing.T) {
+	repo := newStreamRepository(t)
+	var sizes []int
+	total := 0
+	err := repo.IterateBatch(context.Background(), common.Query{}, new(record), 3, func(batch interface{}) error {
+		rows := batch.([]record)
+		sizes = append(sizes, len(rows))
+		for _, r := range rows {
+			if r.Id == 0 {
+				t.Errorf("unexpected row %+v", r)
+			}
+			total++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 7 || len(sizes) != 3 || sizes[2] != 1 {
+		t.Errorf("unexpected batches %v", sizes)
+	}
+	if err = repo.IterateBatch(context.Background(), common.Query{}, new(record), 0, func(interface{}) error { return nil }); err == nil {
+		t.Error("expected error for invalid batch size")
+	}
+}
@@ -0,0 +1,104 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/aluka-7/datasource/search"
+	"xorm.io/builder"
+	"xorm.io/xorm"
+)
+
+// TenantColumn 租户列的列名
+const TenantColumn = "tenant_id"
+
+// ErrNoTenant 租户模式下上下文中没有租户，或使用了不带上下文的方法
+var ErrNoTenant = errors.New("上下文中没有租户，拒绝访问数据")
+
+// Tenant 需要按租户隔离的实体嵌入该结构体，如:
+//
+//	type User struct {
+//	    base.Entity `xorm:"extends"`
+//	    base.Tenant `xorm:"extends"`
+//	}
+type Tenant struct {
+	TenantId string `xorm:"varchar(64) not null index"`
+}
+
+func (t *Tenant) SetTenantId(tenantId string) {
+	t.TenantId = tenantId
+}
+
+// TenantAware 嵌入Tenant的实体，租户模式下保存和更新时由BaseRepository设置租户
+type TenantAware interface {
+	SetTenantId(tenantId string)
+}
+
+type tenantKey struct{}
+
+// WithTenant 返回携带租户的上下文
+func WithTenant(ctx context.Context, tenantId string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantId)
+}
+
+// TenantFrom 获取上下文中的租户
+func TenantFrom(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	tenantId, ok := ctx.Value(tenantKey{}).(string)
+	return tenantId, ok && len(tenantId) > 0
+}
+
+/**
+ * 创建租户模式的BaseRepository，所有读取、更新和删除都会加上tenant_id = 上下文中的租户的条件，
+ * 保存时将实体的租户设置为上下文中的租户。上下文中没有租户时返回ErrNoTenant，
+ * 不带上下文的Save、Update、TxSave、TxUpdate也会返回ErrNoTenant，请使用对应的Context方法。
+ * 租户列使用主表的表名限定，关联表(包括一对多关联的EXISTS子查询)中也可以有同名的列。
+ */
+func NewTenantRepository(orm *xorm.Engine, sorm []*xorm.Engine, column map[string]search.Filter) BaseRepository {
+	return BaseRepository{resolver: StaticResolver(orm, sorm), column: column, tenant: true}
+}
+
+// tenantCond 租户模式下返回上下文中租户的过滤条件，否则返回空条件，bean为主表的实体或实体的切片
+func (b *BaseRepository) tenantCond(ctx context.Context, orm *xorm.Engine, bean interface{}) (builder.Cond, error) {
+	if !b.tenant {
+		return builder.NewCond(), nil
+	}
+	tenantId, ok := TenantFrom(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	return builder.Eq{orm.Quote(orm.TableName(elemBean(bean), true) + "." + TenantColumn): tenantId}, nil
+}
+
+// elemBean bean为实体的切片时返回元素类型的新实体，用于获取表名
+func elemBean(bean interface{}) interface{} {
+	t := reflect.Indirect(reflect.ValueOf(bean)).Type()
+	if t.Kind() == reflect.Slice {
+		if t = t.Elem(); t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		return reflect.New(t).Interface()
+	}
+	return bean
+}
+
+// markTenant 租户模式下将上下文中的租户设置到bean中
+func (b *BaseRepository) markTenant(ctx context.Context, bean interface{}) error {
+	if !b.tenant {
+		return nil
+	}
+	tenantId, ok := TenantFrom(ctx)
+	if !ok {
+		return ErrNoTenant
+	}
+	t, ok := bean.(TenantAware)
+	if !ok {
+		return fmt.Errorf("%T没有嵌入base.Tenant，不能在租户模式下使用", bean)
+	}
+	t.SetTenantId(tenantId)
+	return nil
+}
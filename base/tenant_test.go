@@ -0,0 +1,135 @@
+package base_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aluka-7/common"
+	"github.com/aluka-7/datasource/base"
+	"github.com/aluka-7/datasource/search"
+	"xorm.io/xorm"
+)
+
+type order struct {
+	base.Entity `xorm:"extends"`
+	base.Tenant `xorm:"extends"`
+	Name        string `search:"name"`
+}
+
+func TestTenantRepository(t *testing.T) {
+	orm, err := xorm.NewEngine("sqlite3", "file:tenant?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orm.Close()
+	if err = orm.Sync2(new(order)); err != nil {
+		t.Fatal(err)
+	}
+	column, err := search.Columns(orm, new(order))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := base.NewTenantRepository(orm, []*xorm.Engine{orm}, column)
+	a := base.WithTenant(context.Background(), "a")
+	b := base.WithTenant(context.Background(), "b")
+
+	if _, err = repo.Save(&order{Name: "x"}); err != base.ErrNoTenant {
+		t.Errorf("expected ErrNoTenant, got %v", err)
+	}
+	if _, err = repo.SaveContext(context.Background(), &order{Name: "x"}); err != base.ErrNoTenant {
+		t.Errorf("expected ErrNoTenant, got %v", err)
+	}
+	oa, ob := &order{Name: "x"}, &order{Name: "y", Tenant: base.Tenant{TenantId: "a"}}
+	if _, err = repo.SaveContext(a, oa); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.SaveContext(b, ob); err != nil {
+		t.Fatal(err)
+	}
+	if ob.TenantId != "b" {
+		t.Errorf("expected tenant b, got %s", ob.TenantId)
+	}
+
+	var read order
+	if has, err := repo.ReadById(b, oa.Id, &read); err != nil || has {
+		t.Errorf("tenant b read tenant a's row: %v %v", has, err)
+	}
+	if has, err := repo.ReadById(a, oa.Id, &read); err != nil || !has {
+		t.Errorf("tenant a cannot read its row: %v %v", has, err)
+	}
+	if _, err = repo.ReadById(context.Background(), oa.Id, &read); err != base.ErrNoTenant {
+		t.Errorf("expected ErrNoTenant, got %v", err)
+	}
+
+	var list []order
+	if _, err = repo.Query(a, common.Query{}, &list, new(order)); err != nil || len(list) != 1 || list[0].Id != oa.Id {
+		t.Errorf("unexpected rows %+v %v", list, err)
+	}
+	if _, err = repo.Query(context.Background(), common.Query{}, &list, new(order)); err != base.ErrNoTenant {
+		t.Errorf("expected ErrNoTenant, got %v", err)
+	}
+
+	if n, err := repo.UpdateContext(b, oa.Id, &order{Name: "z"}); err != nil || n != 0 {
+		t.Errorf("tenant b updated tenant a's row: %d %v", n, err)
+	}
+	if n, err := repo.UpdateContext(a, oa.Id, &order{Name: "z", Tenant: base.Tenant{TenantId: "b"}}); err != nil || n != 1 {
+		t.Errorf("tenant a cannot update its row: %d %v", n, err)
+	}
+	read = order{}
+	if has, _ := repo.ReadById(a, oa.Id, &read); !has || read.Name != "z" {
+		t.Errorf("update moved row out of tenant a: %+v", read)
+	}
+
+	if n, err := repo.Delete(b, oa.Id, new(order)); err != nil || n != 0 {
+		t.Errorf("tenant b deleted tenant a's row: %d %v", n, err)
+	}
+	if n, err := repo.Delete(a, oa.Id, new(order)); err != nil || n != 1 {
+		t.Errorf("tenant a cannot delete its row: %d %v", n, err)
+	}
+}
+
+type payer struct {
+	base.Entity `xorm:"extends"`
+	base.Tenant `xorm:"extends"`
+	Name        string
+}
+
+type invoice struct {
+	base.Entity `xorm:"extends"`
+	base.Tenant `xorm:"extends"`
+	PayerId     int64
+}
+
+func TestTenantJoin(t *testing.T) {
+	orm, err := xorm.NewEngine("sqlite3", "file:tenantjoin?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orm.Close()
+	if err = orm.Sync2(new(payer), new(invoice)); err != nil {
+		t.Fatal(err)
+	}
+	// 关联表中也有tenant_id，租户条件需要限定为主表的列
+	column := map[string]search.Filter{
+		"payerName": {FieldName: "p.name", Operator: search.EQ, Join: &search.Join{Table: "payer", Alias: "p", On: "p.id = invoice.payer_id"}},
+	}
+	repo := base.NewTenantRepository(orm, []*xorm.Engine{orm}, column)
+	a := base.WithTenant(context.Background(), "a")
+	p := &payer{Name: "x", Tenant: base.Tenant{TenantId: "shared"}}
+	if _, err = orm.Insert(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.SaveContext(a, &invoice{PayerId: p.Id}); err != nil {
+		t.Fatal(err)
+	}
+	cq := common.Query{}
+	cq.SetFiltered("payerName", "x")
+	var list []invoice
+	if _, err = repo.Query(a, cq, &list, new(invoice)); err != nil || len(list) != 1 {
+		t.Errorf("unexpected rows %+v %v", list, err)
+	}
+	n := 0
+	if err = repo.Iterate(a, cq, new(invoice), func(interface{}) error { n++; return nil }); err != nil || n != 1 {
+		t.Errorf("unexpected iterate %d %v", n, err)
+	}
+}
@@ -0,0 +1,45 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/aluka-7/datasource/base"
+
+// 仓库方法span中的行数
+const (
+	RowsAffected = "db.rows_affected" // 写入、更新或删除的行数
+	RowsReturned = "db.rows_returned" // 读取的行数
+)
+
+/**
+ * 使用tp记录链路追踪，带上下文的方法(SaveContext、Search、Iterate等)各创建一个span，
+ * 记录方法名和行数，方法中执行的语句使用该span的上下文，引擎使用datasource.WithTracing时语句的span为其子span。
+ * 读取的行数(db.rows_returned)只记录在仓库方法的span中，语句的span只记录写入的行数。
+ * 不带上下文的方法(Save、Update等)不创建span。租户仓库(NewTenantRepository)同样适用，分片仓库见ShardRepository.Traced。
+ */
+func (b *BaseRepository) Traced(tp trace.TracerProvider) {
+	b.tracer = tp.Tracer(tracerName)
+}
+
+// trace 未启用链路追踪时返回原上下文，end记录行数或错误并结束span
+func (b *BaseRepository) trace(ctx context.Context, method string) (context.Context, func(key string, rows int64, err error)) {
+	if b.tracer == nil {
+		return ctx, func(string, int64, error) {}
+	}
+	ctx, span := b.tracer.Start(ctx, "BaseRepository."+method, trace.WithAttributes(attribute.String("db.operation", method)))
+	return ctx, func(key string, rows int64, err error) {
+		if err != nil && err != sql.ErrNoRows {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else {
+			span.SetAttributes(attribute.Int64(key, rows))
+		}
+		span.End()
+	}
+}
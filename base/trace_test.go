@@ -0,0 +1,133 @@
+package base_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aluka-7/common"
+	"github.com/aluka-7/datasource/base"
+	"github.com/aluka-7/datasource/search"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"xorm.io/xorm"
+)
+
+type tracedArticle struct {
+	base.Entity `xorm:"extends"`
+	Title       string `search:"title"`
+}
+
+func TestTracedRepository(t *testing.T) {
+	orm, err := xorm.NewEngine("sqlite3", "file:trace?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orm.Close()
+	if err = orm.Sync2(new(tracedArticle)); err != nil {
+		t.Fatal(err)
+	}
+	column, err := search.Columns(orm, new(tracedArticle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	repo := base.NewBaseRepository(orm, []*xorm.Engine{orm}, column)
+	repo.Traced(tp)
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+
+	for _, title := range []string{"a", "b", "c"} {
+		if _, err = repo.SaveContext(ctx, &tracedArticle{Title: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var list []tracedArticle
+	if _, err = repo.Query(ctx, common.Query{}, &list, new(tracedArticle)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.Delete(ctx, list[0].Id, new(tracedArticle)); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Iterate(ctx, common.Query{}, new(tracedArticle), func(interface{}) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	expected := []struct {
+		name string
+		key  string
+		rows int64
+	}{
+		{"BaseRepository.SaveContext", base.RowsAffected, 1},
+		{"BaseRepository.SaveContext", base.RowsAffected, 1},
+		{"BaseRepository.SaveContext", base.RowsAffected, 1},
+		{"BaseRepository.Search", base.RowsReturned, 3},
+		{"BaseRepository.Delete", base.RowsAffected, 1},
+		{"BaseRepository.Iterate", base.RowsReturned, 2},
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != len(expected)+1 {
+		t.Fatalf("expected %d spans, got %d", len(expected)+1, len(spans))
+	}
+	for i, e := range expected {
+		span := spans[i]
+		if span.Name != e.name || span.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("unexpected span %s with parent %s", span.Name, span.Parent.SpanID())
+		}
+		var rows int64 = -1
+		for _, attr := range span.Attributes {
+			if string(attr.Key) == e.key {
+				rows = attr.Value.AsInt64()
+			}
+		}
+		if rows != e.rows {
+			t.Errorf("%s: expected %s=%d, got %d", e.name, e.key, e.rows, rows)
+		}
+	}
+
+	// 未启用链路追踪的仓库不创建span
+	exporter.Reset()
+	untraced := base.NewBaseRepository(orm, []*xorm.Engine{orm}, column)
+	if _, err = untraced.SaveContext(ctx, &tracedArticle{Title: "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(exporter.GetSpans()) != 0 {
+		t.Errorf("expected no spans, got %d", len(exporter.GetSpans()))
+	}
+}
+
+func TestTracedShardRepository(t *testing.T) {
+	var shards []base.EngineResolver
+	for i := 0; i < 2; i++ {
+		orm, err := xorm.NewEngine("sqlite3", fmt.Sprintf("file:traceshard%d?mode=memory&cache=shared", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer orm.Close()
+		if err = orm.Sync2(new(tracedArticle)); err != nil {
+			t.Fatal(err)
+		}
+		shards = append(shards, base.StaticResolver(orm, nil))
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	repo := base.NewShardRepository(shards, nil, "Id", base.Modulo())
+	repo.Traced(tp)
+	ctx := context.Background()
+	for i := int64(1); i <= 2; i++ {
+		if _, err := repo.SaveContext(ctx, &tracedArticle{Entity: base.Entity{Id: i}, Title: "a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ok, err := repo.ReadById(ctx, 2, new(tracedArticle)); err != nil || !ok {
+		t.Fatalf("expected article 2, got %v %v", ok, err)
+	}
+	var names []string
+	for _, span := range exporter.GetSpans() {
+		names = append(names, span.Name)
+	}
+	if len(names) != 3 || names[0] != "BaseRepository.SaveContext" || names[2] != "BaseRepository.ReadById" {
+		t.Errorf("unexpected spans %v", names)
+	}
+}
@@ -1,14 +1,18 @@
 package datasource
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/aluka-7/configuration"
+	"github.com/aluka-7/datasource/base"
 	"github.com/aluka-7/utils"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
 	"xorm.io/xorm"
 	xlog "xorm.io/xorm/log"
 	"xorm.io/xorm/names"
@@ -26,26 +30,57 @@ type Config struct {
 	QueryTimeout utils.Duration         `json:"queryTimeout"` // 查询超时时间
 	ExecTimeout  utils.Duration         `json:"execTimeout"`  // 执行超时时间
 	TranTimeout  utils.Duration         `json:"tranTimeout"`  // 事务超时时间
+	SlowQuery    utils.Duration         `json:"slowQuery"`    // 慢查询阈值，执行时间超过该值的语句会被记录，为0时不记录
 	Expand       map[string]interface{} `json:"expand"`
+	Shards       []string               `json:"shards"`  // 逻辑数据源对应的物理数据源
+	Replica      bool                   `json:"replica"` // 只读库(从库)，指标的role标签为replica，引擎与只读授权一样拒绝写操作
+	ReadOnly     bool                   `json:"-"`       // 只读授权，由访问权限决定，引擎会拒绝写操作
 }
 type dataSource struct {
-	systemId   string
-	cfg        configuration.Configuration
-	privileges map[string][]string
+	systemId    string
+	cfg         configuration.Configuration
+	once        sync.Once // 权限只加载一次，之后通过Changed更新
+	lock        sync.RWMutex
+	privileges  map[string][]Grant
+	auditOrm    *xorm.Engine // 不为nil时审计事件同时写入审计表
+	logger      Logger
+	slowQueries map[string]*int64 // 各数据源的慢查询次数
+	metrics     Metrics
+	pools       map[*xorm.Engine]func() // 引擎的连接池指标的注销方法，见Close
+	tracer      trace.Tracer            // 不为nil时每条语句创建span
 }
 type DataSource interface {
 	Config(dsID string) *Config
 	Orm(dsID string) *xorm.Engine
 }
 
+// Manager 数据源的扩展功能(租户、分片、授权、审计、慢查询、关闭引擎)，Engine返回的DataSource都实现了Manager，
+// 通过ds.(datasource.Manager)获取，DataSource保持不变以兼容已有的实现和mock
+type Manager interface {
+	DataSource
+	Tenant(dsID string, router TenantRouter, capacity int) *TenantResolver
+	Shards(dsID string) ([]base.EngineResolver, error)
+	Privileges() []string
+	Audit(orm *xorm.Engine) error
+	SlowQueries() map[string]int64
+	Close(eng *xorm.Engine) error
+}
+
 /**
- * 获取数据库引擎的唯一实例。
+ * 获取数据库引擎的唯一实例，返回值同时实现了Manager。
  *
  * @return
  */
-func Engine(cfg configuration.Configuration, systemId string) DataSource {
-	fmt.Println("Loading Datasource Engine")
-	return &dataSource{cfg: cfg, systemId: systemId, privileges: make(map[string][]string, 0)}
+func Engine(cfg configuration.Configuration, systemId string, opts ...Option) DataSource {
+	d := &dataSource{cfg: cfg, systemId: systemId, privileges: make(map[string][]Grant, 0)}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.logger == nil {
+		d.logger = ZeroLogger(log.With().Str("systemId", systemId).Logger())
+	}
+	d.logger.Info("Loading Datasource Engine")
+	return d
 }
 func (d *dataSource) Config(dsID string) *Config {
 	ds, dsID, err := d.getConfiguration(dsID, d.systemId)
@@ -56,20 +91,107 @@ func (d *dataSource) Config(dsID string) *Config {
 }
 func (d *dataSource) Orm(dsID string) *xorm.Engine {
 	c := d.Config(dsID)
-	eng, err := xorm.NewEngine(c.Dialect, c.Dsn)
+	if len(dsID) == 0 {
+		dsID = d.systemId
+	}
+	eng, err := d.newEngine(dsID, c)
+	if err != nil {
+		panic(fmt.Sprintf("初始化datasource引擎出错%+v", err))
+	}
+	return eng
+}
+
+/**
+ * 获取逻辑数据源的各个物理分片的引擎，用于base.NewShardRepository，
+ * 逻辑数据源的配置中shards为物理数据源的标示，有逻辑数据源的访问权限即可访问其所有分片，分片的引擎使用Close关闭。
+ */
+func (d *dataSource) Shards(dsID string) ([]base.EngineResolver, error) {
+	c, dsID, err := d.getConfiguration(dsID, d.systemId)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Shards) == 0 {
+		return nil, fmt.Errorf("数据源[%s]未配置分片", dsID)
+	}
+	shards := make([]base.EngineResolver, 0, len(c.Shards))
+	for _, v := range c.Shards {
+		config := &Config{}
+		config.ReadOnly = c.ReadOnly // 分片使用逻辑数据源的授权
+		if err = d.readFromConfiguration(v, config); err == nil && len(config.Dsn) == 0 {
+			err = fmt.Errorf("数据源[%s]的分片[%s]未配置dsn", dsID, v)
+		}
+		var eng *xorm.Engine
+		if err == nil {
+			eng, err = d.newEngine(v, config)
+		}
+		if err != nil {
+			for _, shard := range shards {
+				orm, _ := shard.Master(context.Background())
+				_ = d.Close(orm)
+			}
+			return nil, err
+		}
+		shards = append(shards, base.StaticResolver(eng, nil))
+	}
+	return shards, nil
+}
+func (d *dataSource) newEngine(dsID string, c *Config) (*xorm.Engine, error) {
+	dsn, readOnly := c.Dsn, c.ReadOnly || c.Replica
+	if readOnly {
+		dsn = readOnlyDsn(c.Dialect, dsn)
+	}
+	eng, err := xorm.NewEngine(c.Dialect, dsn)
 	if err == nil {
-		eng.ShowSQL(c.Debug) // 则会在控制台打印出生成的SQL语句
+		role := RoleMaster
+		if c.Replica {
+			role = RoleReplica
+		}
+		eng.SetLogger(XormLogger(d.logger, dsID))
+		eng.ShowSQL(c.Debug) // 则会在日志中输出生成的SQL语句
 		if c.EnableLog {
-			eng.Logger().SetLevel(xlog.LOG_DEBUG) // 则会在控制台打印调试及以上的信息
+			eng.Logger().SetLevel(xlog.LOG_DEBUG) // 则会在日志中输出调试及以上的信息
 		}
 		eng.SetTableMapper(names.NewPrefixMapper(names.SnakeMapper{}, c.Prefix))
 		eng.SetMaxIdleConns(c.MinPoolSize)                   // 设置连接池的空闲数大小
 		eng.SetMaxOpenConns(c.MaxPoolSize)                   // 设置最大打开连接数
 		eng.SetConnMaxLifetime(time.Duration(c.IdleTimeout)) // 设置连接的最大生存时间
-	} else {
-		panic(fmt.Sprintf("初始化datasource引擎出错%+v", err))
+		if readOnly {
+			hook := readOnlyHook{}
+			if d.metrics != nil {
+				hook.rejected = func() { d.metrics.IncError(dsID, role, OperationExec, ErrKindReadOnly) }
+			}
+			eng.AddHook(hook)
+		}
+		if c.SlowQuery > 0 {
+			eng.AddHook(&slowQueryHook{dsID: dsID, threshold: time.Duration(c.SlowQuery), logger: d.logger, counter: d.slowCounter(dsID)})
+		}
+		if d.metrics != nil {
+			eng.AddHook(&metricsHook{dsID: dsID, role: role, metrics: d.metrics})
+			unregister := d.metrics.RegisterPool(dsID, role, eng.DB().DB.Stats)
+			d.lock.Lock()
+			if d.pools == nil {
+				d.pools = make(map[*xorm.Engine]func())
+			}
+			d.pools[eng] = unregister
+			d.lock.Unlock()
+		}
+		if d.tracer != nil {
+			eng.AddHook(&tracingHook{dsID: dsID, system: dbSystem(c.Dialect), tracer: d.tracer})
+		}
 	}
-	return eng
+	return eng, err
+}
+
+// Close 关闭Orm、Shards等方法创建的引擎并注销其连接池指标，使用WithMetrics时应使用该方法而不是eng.Close关闭引擎
+func (d *dataSource) Close(eng *xorm.Engine) error {
+	d.lock.Lock()
+	unregister := d.pools[eng]
+	delete(d.pools, eng)
+	d.lock.Unlock()
+	if unregister != nil {
+		unregister()
+	}
+	return eng.Close()
 }
 
 /**
@@ -82,59 +204,97 @@ func (d *dataSource) Orm(dsID string) *xorm.Engine {
  */
 func (d *dataSource) getConfiguration(dsID, csID string) (*Config, string, error) {
 	config := &Config{}
+	var grant Grant
 	// 如果是获取默认的数据源，则使用当前系统的标示，否则鉴权
 	if len(dsID) == 0 || dsID == csID {
 		dsID = csID
 	} else {
-		plist := d.systemPrivileges(csID) // 数据库的访问权限鉴权
-		if len(plist) == 0 || utils.ContainsString(plist, dsID) == -1 {
-			return config, "", fmt.Errorf("系统[%s]无数据源[%s]的访问权限", csID, dsID)
+		var ok bool
+		if grant, ok = findGrant(d.systemPrivileges(csID), dsID); !ok { // 数据库的访问权限鉴权
+			err := fmt.Errorf("系统[%s]无数据源[%s]的访问权限", csID, dsID)
+			d.audit(AccessAudit{SystemId: csID, DsID: dsID, Reason: err.Error()})
+			return config, "", err
 		}
+		d.audit(AccessAudit{SystemId: csID, DsID: dsID, Granted: true, ReadOnly: grant.ReadOnly})
 	}
 	err := d.readFromConfiguration(dsID, config)
+	config.ReadOnly = grant.ReadOnly
 	return config, dsID, err
 }
 
 /**
-加载数据库的访问权限鉴权
+ * 当前系统可以访问的数据源标示，第一个为当前系统的默认数据源，其余为授权访问的数据源(已排序)。
+ */
+func (d *dataSource) Privileges() []string {
+	plist := d.systemPrivileges(d.systemId)
+	dsIDs := make([]string, 0, len(plist)+1)
+	dsIDs = append(dsIDs, d.systemId)
+	for _, v := range plist {
+		if v.DsID != d.systemId {
+			dsIDs = append(dsIDs, v.DsID)
+		}
+	}
+	sort.Strings(dsIDs[1:])
+	return dsIDs
+}
+
+/*
+*
+加载数据库的访问权限鉴权，首次调用时从配置中心加载并监听变化
 */
-func (d *dataSource) systemPrivileges(csID string) []string {
-	d.cfg.Get("base", "datasource", "", []string{"privileges"}, d)
-	plist := d.privileges[csID]
-	fmt.Printf("系统[%s]的数据源权限:%s", csID, strings.Join(plist, ","))
+func (d *dataSource) systemPrivileges(csID string) []Grant {
+	d.once.Do(func() {
+		d.cfg.Get("base", "datasource", "", []string{"privileges"}, d)
+	})
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	plist := make([]Grant, len(d.privileges[csID]))
+	copy(plist, d.privileges[csID])
 	return plist
 }
+
+// Changed 使用配置中心的最新权限替换全部权限，已删除的系统不再保留，配置不合法时保留原有权限
 func (d *dataSource) Changed(data map[string]string) {
-	for _, v := range data {
-		var vl map[string][]string
-		if err := json.Unmarshal([]byte(v), &vl); err == nil {
-			for k, _v := range vl {
-				d.privileges[k] = _v
-			}
+	privileges := make(map[string][]Grant)
+	for k, v := range data {
+		if len(v) == 0 {
+			continue
+		}
+		var vl map[string][]Grant
+		if err := json.Unmarshal([]byte(v), &vl); err != nil {
+			d.logger.Error(err, "解析数据源权限配置失败，保留原有权限", "path", k)
+			return
+		}
+		for k, _v := range vl {
+			privileges[k] = _v
 		}
 	}
+	d.lock.Lock()
+	d.privileges = privileges
+	d.lock.Unlock()
+	d.logger.Info("数据源权限已更新", "privileges", privileges[d.systemId])
 }
 func (d *dataSource) readFromConfiguration(dsID string, config *Config) error {
 	ex := d.readCommonProperties(config)
 	if ex != nil {
 		return ex
 	}
-	fmt.Printf("从配置中心读取数据源配置:/base/datasource/%s\n", dsID)
+	d.logger.Debug("从配置中心读取数据源配置", "dsID", dsID, "path", "/base/datasource/"+dsID)
 	ex = d.cfg.Clazz("base", "datasource", "", dsID, config)
 	if ex != nil {
-		log.Error().Err(ex).Msgf("数据源[%s]的配置获取失败", dsID)
+		d.logger.Error(ex, "数据源的配置获取失败", "dsID", dsID)
 	}
 	return ex
 }
 
 func (d *dataSource) readCommonProperties(config *Config) error {
-	fmt.Println("从配置中心的读取通用数据源配置:/base/datasource/common")
+	d.logger.Debug("从配置中心读取通用数据源配置", "path", "/base/datasource/common")
 	vl, err := d.cfg.String("base", "datasource", "", "common")
 	if err != nil {
-		log.Error().Err(err).Msg("配置中心的通用数据源配置获取失败:%v")
+		d.logger.Error(err, "配置中心的通用数据源配置获取失败")
 	} else {
 		if err = json.Unmarshal([]byte(vl), config); err != nil {
-			log.Error().Err(err).Msg("解析数据源的通用配置失败")
+			d.logger.Error(err, "解析数据源的通用配置失败")
 		}
 	}
 	return err
@@ -1,9 +1,12 @@
 package datasource_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 	"xorm.io/xorm"
 
 	"github.com/aluka-7/common"
@@ -13,7 +16,11 @@ import (
 	"github.com/aluka-7/datasource/base"
 	"github.com/aluka-7/datasource/search"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog"
 	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type Test struct {
@@ -59,7 +66,8 @@ func TestDataSource(t *testing.T) {
 				"email": {FieldName: "email", Operator: search.LIKE},
 				"id":    {FieldName: "id", Operator: search.IN},
 			})
-			se := repo.Session(context.Background())
+			// repo.Session返回的session执行一条语句后自动关闭，事务需要使用NewSession
+			se := orm.NewSession()
 			err := se.Begin()
 			defer se.Close()
 			So(err, ShouldBeNil)
@@ -127,7 +135,7 @@ func TestDataSource(t *testing.T) {
 		})
 		Convey("Test Search Builder Orm Filter EQ", func() {
 			filters := []search.Filter{
-				{"Email", "test@xxxx.cn", search.EQ},
+				{FieldName: "Email", Value: "test@xxxx.cn", Operator: search.EQ},
 			}
 			session := orm.NewSession()
 			var val []Test
@@ -152,3 +160,264 @@ func TestDataSource(t *testing.T) {
 		})
 	})
 }
+
+func TestTenantResolver(t *testing.T) {
+	initConfig(t)
+	Convey("test TenantResolver", t, func() {
+		resolver := datasource.Engine(conf, "1000").(datasource.Manager).Tenant("", func(tenantId string) (datasource.TenantRoute, error) {
+			switch tenantId {
+			case "a", "b", "c":
+				return datasource.TenantRoute{Prefix: "os_" + tenantId + "_"}, nil
+			case "x":
+				return datasource.TenantRoute{DsID: "9999"}, nil
+			}
+			return datasource.TenantRoute{}, fmt.Errorf("租户[%s]不存在", tenantId)
+		}, 2)
+		ctxA := base.WithTenant(context.Background(), "a")
+		ctxB := base.WithTenant(context.Background(), "b")
+		Convey("Test route by prefix", func() {
+			a, err := resolver.Master(ctxA)
+			So(err, ShouldBeNil)
+			b, err := resolver.Replica(ctxB)
+			So(err, ShouldBeNil)
+			So(a.TableName(new(Test)), ShouldEqual, "os_a_test")
+			So(b.TableName(new(Test)), ShouldEqual, "os_b_test")
+			again, err := resolver.Master(ctxA)
+			So(err, ShouldBeNil)
+			So(again, ShouldEqual, a)
+		})
+		Convey("Test repository through resolver", func() {
+			repo := base.NewResolverRepository(resolver, nil)
+			for _, ctx := range []context.Context{ctxA, ctxB} {
+				So(repo.Session(ctx).DropTable(new(Test)), ShouldBeNil)
+				So(repo.Session(ctx).Sync2(new(Test)), ShouldBeNil)
+			}
+			_, err := repo.SaveContext(ctxA, &Test{Email: "a@xxxx.cn"})
+			So(err, ShouldBeNil)
+			var list []Test
+			_, err = repo.Query(ctxB, common.Query{}, &list, new(Test))
+			So(err, ShouldBeNil)
+			So(len(list), ShouldEqual, 0)
+			_, err = repo.Query(ctxA, common.Query{}, &list, new(Test))
+			So(err, ShouldBeNil)
+			So(len(list), ShouldEqual, 1)
+			_, err = repo.Query(context.Background(), common.Query{}, &list, new(Test))
+			So(err, ShouldEqual, base.ErrNoTenant)
+		})
+		Convey("Test LRU eviction", func() {
+			resolver.SetCloseDelay(20 * time.Millisecond)
+			a, _ := resolver.Master(ctxA)
+			_, _ = resolver.Master(ctxB)
+			session := a.NewSession()
+			So(session.Begin(), ShouldBeNil)
+			_, err := resolver.Master(base.WithTenant(context.Background(), "c"))
+			So(err, ShouldBeNil)
+			So(a.Ping(), ShouldBeNil)
+			time.Sleep(100 * time.Millisecond)
+			// 未结束的事务使被淘汰的引擎继续延迟关闭
+			So(a.Ping(), ShouldBeNil)
+			So(session.Commit(), ShouldBeNil)
+			So(session.Close(), ShouldBeNil)
+			time.Sleep(100 * time.Millisecond)
+			So(a.Ping(), ShouldNotBeNil)
+			again, err := resolver.Master(ctxA)
+			So(err, ShouldBeNil)
+			So(again, ShouldNotEqual, a)
+		})
+		Convey("Test concurrent creation of the same route", func() {
+			engines := make(chan *xorm.Engine, 8)
+			var wg sync.WaitGroup
+			for i := 0; i < cap(engines); i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					eng, _ := resolver.Master(ctxA)
+					engines <- eng
+				}()
+			}
+			wg.Wait()
+			close(engines)
+			first := <-engines
+			So(first, ShouldNotBeNil)
+			for eng := range engines {
+				So(eng, ShouldEqual, first)
+			}
+			So(first.Ping(), ShouldBeNil)
+		})
+		Convey("Test unknown tenant and missing privilege", func() {
+			_, err := resolver.Master(base.WithTenant(context.Background(), "y"))
+			So(err, ShouldNotBeNil)
+			_, err = resolver.Master(base.WithTenant(context.Background(), "x"))
+			So(err, ShouldNotBeNil)
+		})
+		Reset(func() {
+			So(resolver.Close(), ShouldBeNil)
+		})
+	})
+}
+
+func TestPrivileges(t *testing.T) {
+	cfg := configuration.MockEngine(t, backends.StoreConfig{Exp: map[string]string{
+		"/system/base/datasource/privileges": "{\"1000\":[{\"dsID\":\"1300\",\"readOnly\":true},\"1200\"],\"2000\":[\"1000\"]}",
+		"/system/base/datasource/common":     "{\"dialect\":\"sqlite3\",\"minPoolSize\":2}",
+		"/system/base/datasource/1000":       "{\"dsn\":\"file:grant?mode=memory&cache=shared\",\"prefix\":\"os_\"}",
+		"/system/base/datasource/1200":       "{\"dsn\":\"file:privileges?mode=memory\"}",
+		"/system/base/datasource/1300":       "{\"dsn\":\"file:grant?mode=memory&cache=shared\",\"prefix\":\"os_\",\"readOnly\":false}",
+	}})
+	Convey("test Privileges", t, func() {
+		ds := datasource.Engine(cfg, "1000").(datasource.Manager)
+		So(ds.Privileges(), ShouldResemble, []string{"1000", "1200", "1300"})
+		So(ds.Config("1200").Dsn, ShouldEqual, "file:privileges?mode=memory")
+		So(func() { ds.Config("2000") }, ShouldPanic)
+
+		So(ds.Config("1200").ReadOnly, ShouldBeFalse)
+		So(ds.Config("1300").ReadOnly, ShouldBeTrue)
+
+		orm, ro := ds.Orm(""), ds.Orm("1300")
+		defer ro.Close()
+		defer orm.Close()
+		So(orm.Sync2(new(Test)), ShouldBeNil)
+		_, err := orm.Insert(&Test{Email: "rw@xxxx.cn"})
+		So(err, ShouldBeNil)
+		var list []Test
+		So(ro.Find(&list), ShouldBeNil)
+		So(len(list), ShouldEqual, 1)
+		_, err = ro.Insert(&Test{Email: "ro@xxxx.cn"})
+		So(err, ShouldEqual, datasource.ErrReadOnly)
+		_, err = ro.Exec("DELETE FROM os_test")
+		So(err, ShouldEqual, datasource.ErrReadOnly)
+		_, err = ro.Exec("WITH x AS (SELECT 1) DELETE FROM os_test")
+		So(err, ShouldEqual, datasource.ErrReadOnly)
+		for _, sql := range []string{
+			"SELECT 1; INSERT INTO os_test (email) VALUES ('x')",
+			"SELECT * FROM os_test FOR UPDATE",
+			"SELECT * INTO backup FROM os_test",
+		} {
+			_, err = ro.Exec(sql)
+			So(err, ShouldEqual, datasource.ErrReadOnly)
+		}
+		_, err = ro.Exec("SELECT * FROM os_test WHERE email = 'a;b into c'")
+		So(err, ShouldBeNil)
+		// 绕过钩子直接使用连接也无法写入
+		_, err = ro.DB().DB.Exec("DELETE FROM os_test")
+		So(err, ShouldNotBeNil)
+		list = nil
+		So(ro.Find(&list), ShouldBeNil)
+		So(len(list), ShouldEqual, 1)
+
+		So(ds.Audit(orm), ShouldBeNil)
+		ds.Config("1300")
+		So(func() { ds.Config("2000") }, ShouldPanic)
+		var audits []datasource.AccessAudit
+		So(orm.OrderBy("id").Find(&audits), ShouldBeNil)
+		So(len(audits), ShouldEqual, 2)
+		So(audits[0].DsID, ShouldEqual, "1300")
+		So(audits[0].Granted && audits[0].ReadOnly, ShouldBeTrue)
+		So(audits[1].Granted, ShouldBeFalse)
+		So(audits[1].Reason, ShouldNotBeEmpty)
+
+		listener := ds.(configuration.ChangedListener)
+		listener.Changed(map[string]string{"/system/base/datasource/privileges": "{\"2000\":[\"1000\"]}"})
+		So(ds.Privileges(), ShouldResemble, []string{"1000"})
+		So(func() { ds.Config("1200") }, ShouldPanic)
+
+		listener.Changed(map[string]string{"/system/base/datasource/privileges": "not json"})
+		So(ds.Privileges(), ShouldResemble, []string{"1000"})
+	})
+}
+
+type recordLogger struct {
+	entries []string
+}
+
+func (r *recordLogger) record(level, msg string, keyvals []interface{}) {
+	r.entries = append(r.entries, fmt.Sprint(level, " ", msg, " ", keyvals))
+}
+func (r *recordLogger) Debug(msg string, keyvals ...interface{}) { r.record("debug", msg, keyvals) }
+func (r *recordLogger) Info(msg string, keyvals ...interface{})  { r.record("info", msg, keyvals) }
+func (r *recordLogger) Warn(msg string, keyvals ...interface{})  { r.record("warn", msg, keyvals) }
+func (r *recordLogger) Error(err error, msg string, keyvals ...interface{}) {
+	r.record("error", msg, append(keyvals, err))
+}
+
+func TestLogger(t *testing.T) {
+	initConfig(t)
+	Convey("test Logger", t, func() {
+		logger := &recordLogger{}
+		orm := datasource.Engine(conf, "1000", datasource.WithLogger(logger)).Orm("")
+		defer orm.Close()
+		_, err := orm.Exec("SELECT 1")
+		So(err, ShouldBeNil)
+		So(logger.entries[0], ShouldEqual, "info Loading Datasource Engine []")
+		last := logger.entries[len(logger.entries)-1]
+		So(last, ShouldStartWith, "info 执行SQL [dsID 1000 sql SELECT 1")
+
+		var buf bytes.Buffer
+		datasource.ZeroLogger(zerolog.New(&buf)).Warn("消息", "dsID", "1000")
+		So(buf.String(), ShouldEqual, "{\"level\":\"warn\",\"dsID\":\"1000\",\"message\":\"消息\"}\n")
+	})
+}
+
+func TestSlowQuery(t *testing.T) {
+	cfg := configuration.MockEngine(t, backends.StoreConfig{Exp: map[string]string{
+		"/system/base/datasource/common": "{\"dialect\":\"sqlite3\",\"slowQuery\":\"1ns\"}",
+		"/system/base/datasource/1000":   "{\"dsn\":\"file:slow?mode=memory\"}",
+	}})
+	Convey("test SlowQuery", t, func() {
+		logger := &recordLogger{}
+		ds := datasource.Engine(cfg, "1000", datasource.WithLogger(logger)).(datasource.Manager)
+		orm := ds.Orm("")
+		defer orm.Close()
+		_, err := orm.QueryString("SELECT ?, ?", "secret", 42)
+		So(err, ShouldBeNil)
+		So(ds.SlowQueries()["1000"], ShouldEqual, 1)
+		last := logger.entries[len(logger.entries)-1]
+		So(last, ShouldStartWith, "warn 慢查询 [dsID 1000 sql SELECT ?, ? args [<string(6)> 42]")
+		So(last, ShouldContainSubstring, "datasource_test.go:")
+	})
+}
+
+func TestTracing(t *testing.T) {
+	cfg := configuration.MockEngine(t, backends.StoreConfig{Exp: map[string]string{
+		"/system/base/datasource/common": "{\"dialect\":\"sqlite3\",\"minPoolSize\":1}",
+		"/system/base/datasource/1000":   "{\"dsn\":\"file:tracing?mode=memory&cache=shared\"}",
+	}})
+	Convey("test SanitizeSQL", t, func() {
+		So(datasource.SanitizeSQL("SELECT * FROM `user` WHERE name='a''b' AND age>18 AND id=?"), ShouldEqual, "SELECT * FROM `user` WHERE name=? AND age>? AND id=?")
+		So(datasource.SanitizeSQL("UPDATE t1 SET \"col2\"=-1.5, v='x\\'y' WHERE id=$1"), ShouldEqual, "UPDATE t1 SET \"col2\"=-?, v=? WHERE id=$1")
+	})
+	Convey("test Tracing", t, func() {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		ds := datasource.Engine(cfg, "1000", datasource.WithTracing(tp))
+		orm := ds.Orm("")
+		defer orm.Close()
+		ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+		_, err := orm.Context(ctx).Exec("CREATE TABLE item (id INTEGER PRIMARY KEY, name TEXT)")
+		So(err, ShouldBeNil)
+		_, err = orm.Context(ctx).Exec("INSERT INTO item (id, name) VALUES (1, 'secret'), (2, ?)", "x")
+		So(err, ShouldBeNil)
+		_, err = orm.Context(ctx).QueryString("SELECT * FROM missing")
+		So(err, ShouldNotBeNil)
+		parent.End()
+
+		spans := exporter.GetSpans()
+		So(len(spans), ShouldEqual, 4)
+		attrs := func(i int) map[string]interface{} {
+			m := map[string]interface{}{}
+			for _, attr := range spans[i].Attributes {
+				m[string(attr.Key)] = attr.Value.AsInterface()
+			}
+			return m
+		}
+		insert := attrs(1)
+		So(spans[1].Name, ShouldEqual, "INSERT 1000")
+		So(spans[1].Parent.SpanID(), ShouldEqual, parent.SpanContext().SpanID())
+		So(insert["db.system"], ShouldEqual, "sqlite")
+		So(insert["db.name"], ShouldEqual, "1000")
+		So(insert["db.statement"], ShouldEqual, "INSERT INTO item (id, name) VALUES (?, ?), (?, ?)")
+		So(insert["db.rows_affected"], ShouldEqual, 2)
+		So(spans[2].Status.Code, ShouldEqual, codes.Error)
+		So(spans[2].Status.Description, ShouldEqual, datasource.ErrKindSchema)
+	})
+}
@@ -1,6 +1,12 @@
 package datasource
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+
 	"github.com/go-sql-driver/mysql"
 )
 
@@ -18,3 +24,64 @@ func CheckDBError(err error) (e DbError) {
 	}
 	return
 }
+
+// 错误分类，用于指标的kind标签
+const (
+	ErrKindDuplicate    = "duplicate"     // 唯一键冲突
+	ErrKindDeadlock     = "deadlock"      // 死锁
+	ErrKindLockTimeout  = "lock_timeout"  // 等待锁超时
+	ErrKindLocked       = "locked"        // 数据库被锁定(sqlite3)
+	ErrKindSyntax       = "syntax"        // SQL语法错误
+	ErrKindSchema       = "schema"        // 表或列不存在
+	ErrKindAccessDenied = "access_denied" // 数据库拒绝访问
+	ErrKindReadOnly     = "read_only"     // 只读授权的数据源执行写操作
+	ErrKindTimeout      = "timeout"       // 上下文超时
+	ErrKindCanceled     = "canceled"      // 上下文被取消
+	ErrKindConnection   = "connection"    // 连接失效
+	ErrKindOther        = "other"
+)
+
+// ErrorKind 对执行语句的错误进行分类，无法识别的错误返回ErrKindOther
+func ErrorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrReadOnly):
+		return ErrKindReadOnly
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrKindTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrKindCanceled
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, mysql.ErrInvalidConn), errors.Is(err, sql.ErrConnDone):
+		return ErrKindConnection
+	}
+	var me *mysql.MySQLError
+	if errors.As(err, &me) {
+		switch me.Number {
+		case DBDuplicateEntryKey:
+			return ErrKindDuplicate
+		case 1213:
+			return ErrKindDeadlock
+		case 1205:
+			return ErrKindLockTimeout
+		case 1064:
+			return ErrKindSyntax
+		case 1146, 1054:
+			return ErrKindSchema
+		case 1044, 1045, 1142:
+			return ErrKindAccessDenied
+		}
+		return ErrKindOther
+	}
+	// sqlite3等驱动的错误按照错误信息分类
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "UNIQUE constraint failed"):
+		return ErrKindDuplicate
+	case strings.Contains(msg, "database is locked"), strings.Contains(msg, "database table is locked"):
+		return ErrKindLocked
+	case strings.Contains(msg, "syntax error"):
+		return ErrKindSyntax
+	case strings.Contains(msg, "no such table"), strings.Contains(msg, "no such column"):
+		return ErrKindSchema
+	}
+	return ErrKindOther
+}
@@ -11,6 +11,9 @@ require (
 	github.com/rs/zerolog v1.27.0
 	github.com/samuel/go-zookeeper v0.0.0-20190923202752-2cc03de413da // indirect
 	github.com/smartystreets/goconvey v1.6.4
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/sdk v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
 	xorm.io/builder v0.3.9
 	xorm.io/xorm v1.0.7
 )
@@ -0,0 +1,152 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"xorm.io/xorm/contexts"
+)
+
+// ErrReadOnly 只读授权的数据源拒绝执行写操作
+var ErrReadOnly = errors.New("只读授权的数据源不允许执行写操作")
+
+/**
+ * 数据源的访问授权，/base/datasource/privileges中每个系统的授权列表的元素可以是数据源标示的字符串(读写授权)，
+ * 也可以是{"dsID":"1200","readOnly":true}形式的对象，如:
+ *   {"1000":["1200",{"dsID":"1300","readOnly":true}]}
+ */
+type Grant struct {
+	DsID     string `json:"dsID"`
+	ReadOnly bool   `json:"readOnly"`
+}
+
+func (g *Grant) UnmarshalJSON(data []byte) error {
+	var dsID string
+	if err := json.Unmarshal(data, &dsID); err == nil {
+		*g = Grant{DsID: dsID}
+		return nil
+	}
+	type grant Grant
+	return json.Unmarshal(data, (*grant)(g))
+}
+
+func (g Grant) String() string {
+	if g.ReadOnly {
+		return g.DsID + "(只读)"
+	}
+	return g.DsID
+}
+
+func findGrant(grants []Grant, dsID string) (Grant, bool) {
+	for _, v := range grants {
+		if v.DsID == dsID {
+			return v, true
+		}
+	}
+	return Grant{}, false
+}
+
+/**
+ * 只读授权的引擎在连接上启用只读模式，即使语句绕过了readOnlyHook的检查也无法写入:
+ *   sqlite3   _query_only=1
+ *   mysql     transaction_read_only=1(MySQL 5.7.20及以上，连接时执行SET)
+ *   postgres  default_transaction_read_only=on
+ * 其他数据库只依赖readOnlyHook，建议同时为只读授权配置只读的数据库账号。
+ */
+var readOnlyParams = map[string][2]string{
+	"sqlite3":  {"_query_only", "1"},
+	"mysql":    {"transaction_read_only", "1"},
+	"postgres": {"default_transaction_read_only", "on"},
+}
+
+// readOnlyDsn 在dsn中加入只读参数，dsn中已有该参数时不修改
+func readOnlyDsn(dialect, dsn string) string {
+	param, ok := readOnlyParams[dialect]
+	if !ok || strings.Contains(dsn, param[0]+"=") {
+		return dsn
+	}
+	if dialect == "postgres" && !strings.Contains(dsn, "://") { // key=value形式的dsn
+		return dsn + " " + param[0] + "=" + param[1]
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + param[0] + "=" + param[1]
+	}
+	return dsn + "?" + param[0] + "=" + param[1]
+}
+
+// readOnlyHook 只读授权的引擎在执行语句前检查语句类型，拒绝所有非查询语句
+type readOnlyHook struct {
+	rejected func() // 被拒绝的语句不会执行，其他钩子的AfterProcess不会被调用，需要单独记录
+}
+
+func (h readOnlyHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	if !isReadStatement(c.SQL) {
+		if h.rejected != nil {
+			h.rejected()
+		}
+		return c.Ctx, ErrReadOnly
+	}
+	return c.Ctx, nil
+}
+
+func (readOnlyHook) AfterProcess(*contexts.ContextHook) error {
+	return nil
+}
+
+// 允许的只读语句，WITH和PRAGMA单独判断
+var readStatements = []string{"SELECT", "SHOW", "EXPLAIN", "DESCRIBE", "DESC"}
+
+// 可能出现在WITH中的写操作
+var writeKeywords = []string{"INSERT", "UPDATE", "DELETE", "MERGE", "REPLACE"}
+
+// 加锁或写入的查询，如SELECT ... FOR UPDATE、SELECT ... LOCK IN SHARE MODE
+var lockingClauses = [][2]string{{"FOR", "UPDATE"}, {"FOR", "SHARE"}, {"FOR", "NO"}, {"FOR", "KEY"}, {"LOCK", "IN"}}
+
+/**
+ * 是否为只读语句，字符串字面量不参与判断(见SanitizeSQL)，以下语句不是只读语句:
+ * 多条语句(如SELECT 1; DELETE ...)、加锁的查询(FOR UPDATE等)、带INTO的查询(INTO OUTFILE、SELECT INTO新表)。
+ */
+func isReadStatement(sql string) bool {
+	sql = strings.TrimRight(SanitizeSQL(sql), " \t\r\n;")
+	if strings.Contains(sql, ";") {
+		return false
+	}
+	sql = strings.TrimLeft(sql, " \t\r\n(")
+	fields := strings.FieldsFunc(strings.ToUpper(sql), func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_')
+	})
+	if len(fields) == 0 {
+		return false
+	}
+	for i, f := range fields {
+		if f == "INTO" {
+			return false
+		}
+		for _, c := range lockingClauses {
+			if f == c[0] && i+1 < len(fields) && fields[i+1] == c[1] {
+				return false
+			}
+		}
+	}
+	switch fields[0] {
+	case "WITH":
+		for _, f := range fields {
+			for _, w := range writeKeywords {
+				if f == w {
+					return false
+				}
+			}
+		}
+		return true
+	case "PRAGMA":
+		return !strings.Contains(sql, "=")
+	}
+	for _, v := range readStatements {
+		if fields[0] == v {
+			return true
+		}
+	}
+	return false
+}
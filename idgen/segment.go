@@ -0,0 +1,87 @@
+package idgen
+
+import (
+	"fmt"
+	"sync"
+
+	"xorm.io/xorm"
+)
+
+// IdSegment 号段表，每个业务标示一行，MaxId为已分配出去的最大ID
+type IdSegment struct {
+	BizTag  string `xorm:"varchar(64) pk"`
+	MaxId   int64  `xorm:"bigint not null"`
+	Step    int64  `xorm:"bigint not null"`
+	Version int64  `xorm:"version"`
+}
+
+/**
+ * 号段模式的ID生成器，每次从数据库的号段表中申请step个ID缓存在内存中，用完后再申请，
+ * 多个实例通过乐观锁并发申请，ID在同一业务标示内唯一且单调递增(多实例时整体趋势递增)。
+ */
+type Segment struct {
+	lock   sync.Mutex
+	orm    *xorm.Engine
+	bizTag string
+	step   int64
+	cur    int64 // 下一个可用的ID
+	max    int64 // 当前号段的最大ID
+}
+
+// NewSegment 创建号段模式的ID生成器，号段表和业务标示的行不存在时自动创建
+func NewSegment(orm *xorm.Engine, bizTag string, step int64) (*Segment, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("号段的步长必须大于0")
+	}
+	if err := orm.Sync2(new(IdSegment)); err != nil {
+		return nil, err
+	}
+	if exist, err := orm.Exist(&IdSegment{BizTag: bizTag}); err != nil {
+		return nil, err
+	} else if !exist {
+		// 并发创建时主键冲突，再次确认是否已存在
+		if _, err = orm.Insert(&IdSegment{BizTag: bizTag, Step: step}); err != nil {
+			if exist, _ = orm.Exist(&IdSegment{BizTag: bizTag}); !exist {
+				return nil, err
+			}
+		}
+	}
+	return &Segment{orm: orm, bizTag: bizTag, step: step}, nil
+}
+
+func (s *Segment) NextId() (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.cur == 0 || s.cur > s.max {
+		if err := s.allocate(); err != nil {
+			return 0, err
+		}
+	}
+	id := s.cur
+	s.cur++
+	return id, nil
+}
+
+// allocate 使用乐观锁申请新的号段，版本冲突时重试
+func (s *Segment) allocate() error {
+	for i := 0; i < 10; i++ {
+		seg := &IdSegment{BizTag: s.bizTag}
+		has, err := s.orm.Get(seg)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return fmt.Errorf("号段表中不存在业务标示[%s]", s.bizTag)
+		}
+		max := seg.MaxId + s.step
+		n, err := s.orm.ID(s.bizTag).Cols("max_id", "step").Update(&IdSegment{MaxId: max, Step: s.step, Version: seg.Version})
+		if err != nil {
+			return err
+		}
+		if n == 1 {
+			s.cur, s.max = seg.MaxId+1, max
+			return nil
+		}
+	}
+	return fmt.Errorf("业务标示[%s]申请号段冲突次数过多", s.bizTag)
+}
@@ -0,0 +1,52 @@
+package idgen
+
+import (
+	"sync"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"xorm.io/xorm"
+)
+
+func TestSegment(t *testing.T) {
+	orm, err := xorm.NewEngine("sqlite3", "file:segment?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orm.Close()
+	a, err := NewSegment(orm, "order", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewSegment(orm, "order", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lock sync.Mutex
+	seen := make(map[int64]bool)
+	var wg sync.WaitGroup
+	for _, g := range []*Segment{a, b} {
+		wg.Add(1)
+		go func(g *Segment) {
+			defer wg.Done()
+			for i := 0; i < 55; i++ {
+				id, err := g.NextId()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				lock.Lock()
+				if seen[id] {
+					t.Errorf("duplicated id %d", id)
+				}
+				seen[id] = true
+				lock.Unlock()
+			}
+		}(g)
+	}
+	wg.Wait()
+	seg := &IdSegment{BizTag: "order"}
+	if has, err := orm.Get(seg); err != nil || !has || seg.MaxId != 120 {
+		t.Errorf("unexpected segment %+v %v", seg, err)
+	}
+}
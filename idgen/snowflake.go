@@ -0,0 +1,94 @@
+package idgen
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aluka-7/configuration"
+)
+
+const (
+	workerBits   = 10
+	sequenceBits = 12
+	MaxWorkerId  = 1<<workerBits - 1
+	maxSequence  = 1<<sequenceBits - 1
+	maxBackwards = 5 * time.Millisecond // 允许等待的最大时钟回拨
+)
+
+// Epoch 雪花算法的起始时间(2021-01-01 00:00:00 UTC)，41位的毫秒数可以使用约69年
+var Epoch = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeConfig 配置中心中/base/idgen/{systemId}的配置
+type SnowflakeConfig struct {
+	WorkerId int64 `json:"workerId"` // 机器标示，0~1023，同一系统的每个实例必须不同
+}
+
+/**
+ * 雪花算法的ID生成器，ID由41位毫秒时间戳、10位机器标示和12位序列号组成，
+ * 同一个机器每毫秒最多生成4096个ID，ID按时间递增。
+ */
+type Snowflake struct {
+	lock     sync.Mutex
+	workerId int64
+	last     int64 // 上次生成ID的毫秒数
+	sequence int64
+	now      func() time.Time
+}
+
+func NewSnowflake(workerId int64) (*Snowflake, error) {
+	if workerId < 0 || workerId > MaxWorkerId {
+		return nil, fmt.Errorf("机器标示[%d]必须在0~%d之间", workerId, MaxWorkerId)
+	}
+	return &Snowflake{workerId: workerId, now: time.Now}, nil
+}
+
+// SnowflakeFromConfiguration 从配置中心的/base/idgen/{systemId}读取机器标示并创建雪花算法的ID生成器
+func SnowflakeFromConfiguration(cfg configuration.Configuration, systemId string) (*Snowflake, error) {
+	c := &SnowflakeConfig{WorkerId: -1}
+	if err := cfg.Clazz("base", "idgen", "", systemId, c); err != nil {
+		return nil, fmt.Errorf("从配置中心读取系统[%s]的ID生成器配置失败:%v", systemId, err)
+	}
+	return NewSnowflake(c.WorkerId)
+}
+
+func (s *Snowflake) NextId() (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := s.millis()
+	if now < s.last {
+		// 时钟回拨较小时等待，否则拒绝生成以避免重复
+		backwards := time.Duration(s.last-now) * time.Millisecond
+		if backwards > maxBackwards {
+			return 0, fmt.Errorf("时钟回拨了%v，拒绝生成ID", backwards)
+		}
+		time.Sleep(backwards)
+		if now = s.millis(); now < s.last {
+			return 0, fmt.Errorf("时钟回拨了%v，拒绝生成ID", time.Duration(s.last-now)*time.Millisecond)
+		}
+	}
+	if now == s.last {
+		s.sequence = (s.sequence + 1) & maxSequence
+		if s.sequence == 0 {
+			// 当前毫秒的序列号已用完，等待下一毫秒
+			for now <= s.last {
+				time.Sleep(100 * time.Microsecond)
+				now = s.millis()
+			}
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.last = now
+	return now<<(workerBits+sequenceBits) | s.workerId<<sequenceBits | s.sequence, nil
+}
+
+func (s *Snowflake) millis() int64 {
+	return s.now().Sub(Epoch).Milliseconds()
+}
+
+// Parse 拆分ID中的生成时间、机器标示和序列号
+func Parse(id int64) (t time.Time, workerId, sequence int64) {
+	t = Epoch.Add(time.Duration(id>>(workerBits+sequenceBits)) * time.Millisecond)
+	return t, id >> sequenceBits & MaxWorkerId, id & maxSequence
+}
@@ -0,0 +1,44 @@
+package idgen
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnowflake(t *testing.T) {
+	if _, err := NewSnowflake(MaxWorkerId + 1); err == nil {
+		t.Error("expected error for invalid worker id")
+	}
+	s, err := NewSnowflake(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[int64]bool)
+	var last int64
+	for i := 0; i < 10000; i++ {
+		id, err := s.NextId()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[id] || id <= last {
+			t.Fatalf("id %d is duplicated or not increasing after %d", id, last)
+		}
+		seen[id], last = true, id
+	}
+	if ts, worker, _ := Parse(last); worker != 7 || time.Since(ts) > time.Minute {
+		t.Errorf("unexpected parsed id %v %d", ts, worker)
+	}
+}
+
+func TestSnowflakeClockBackwards(t *testing.T) {
+	s, _ := NewSnowflake(1)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	if _, err := s.NextId(); err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return now.Add(-time.Second) }
+	if _, err := s.NextId(); err == nil {
+		t.Error("expected error when clock moves backwards")
+	}
+}
@@ -0,0 +1,120 @@
+package datasource
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog"
+	xlog "xorm.io/xorm/log"
+)
+
+// Logger 数据源的日志接口，keyvals为交替出现的字段名和字段值，如"dsID", "1000"
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(err error, msg string, keyvals ...interface{})
+}
+
+// Option 创建Engine时的可选项
+type Option func(d *dataSource)
+
+// WithLogger 使用指定的日志，默认使用zerolog的全局日志并带有systemId字段
+func WithLogger(logger Logger) Option {
+	return func(d *dataSource) {
+		d.logger = logger
+	}
+}
+
+// ZeroLogger 使用zerolog输出日志
+func ZeroLogger(logger zerolog.Logger) Logger {
+	return zeroLogger{logger: logger}
+}
+
+type zeroLogger struct {
+	logger zerolog.Logger
+}
+
+func (z zeroLogger) Debug(msg string, keyvals ...interface{}) {
+	z.logger.Debug().Fields(keyvals).Msg(msg)
+}
+
+func (z zeroLogger) Info(msg string, keyvals ...interface{}) {
+	z.logger.Info().Fields(keyvals).Msg(msg)
+}
+
+func (z zeroLogger) Warn(msg string, keyvals ...interface{}) {
+	z.logger.Warn().Fields(keyvals).Msg(msg)
+}
+
+func (z zeroLogger) Error(err error, msg string, keyvals ...interface{}) {
+	z.logger.Error().Err(err).Fields(keyvals).Msg(msg)
+}
+
+/**
+ * 将xorm的日志(包括ShowSQL输出的SQL)转换为Logger的日志，每条日志都带有dsID字段，
+ * SQL日志为Info级别，执行出错的SQL为Error级别。
+ */
+func XormLogger(logger Logger, dsID string) xlog.ContextLogger {
+	return &xormLogger{logger: logger, dsID: dsID, level: xlog.LOG_INFO}
+}
+
+type xormLogger struct {
+	logger  Logger
+	dsID    string
+	level   xlog.LogLevel
+	showSQL bool
+}
+
+func (x *xormLogger) BeforeSQL(xlog.LogContext) {}
+
+func (x *xormLogger) AfterSQL(ctx xlog.LogContext) {
+	keyvals := []interface{}{"dsID", x.dsID, "sql", ctx.SQL, "args", ctx.Args, "duration", ctx.ExecuteTime}
+	if session, ok := ctx.Ctx.Value(xlog.SessionIDKey).(string); ok {
+		keyvals = append(keyvals, "session", session)
+	}
+	if ctx.Err != nil {
+		x.logger.Error(ctx.Err, "执行SQL出错", keyvals...)
+	} else {
+		x.logger.Info("执行SQL", keyvals...)
+	}
+}
+
+func (x *xormLogger) Debugf(format string, v ...interface{}) {
+	if x.level <= xlog.LOG_DEBUG {
+		x.logger.Debug(fmt.Sprintf(format, v...), "dsID", x.dsID)
+	}
+}
+
+func (x *xormLogger) Infof(format string, v ...interface{}) {
+	if x.level <= xlog.LOG_INFO {
+		x.logger.Info(fmt.Sprintf(format, v...), "dsID", x.dsID)
+	}
+}
+
+func (x *xormLogger) Warnf(format string, v ...interface{}) {
+	if x.level <= xlog.LOG_WARNING {
+		x.logger.Warn(fmt.Sprintf(format, v...), "dsID", x.dsID)
+	}
+}
+
+func (x *xormLogger) Errorf(format string, v ...interface{}) {
+	if x.level <= xlog.LOG_ERR {
+		x.logger.Error(nil, fmt.Sprintf(format, v...), "dsID", x.dsID)
+	}
+}
+
+func (x *xormLogger) Level() xlog.LogLevel {
+	return x.level
+}
+
+func (x *xormLogger) SetLevel(l xlog.LogLevel) {
+	x.level = l
+}
+
+func (x *xormLogger) ShowSQL(show ...bool) {
+	x.showSQL = len(show) == 0 || show[0]
+}
+
+func (x *xormLogger) IsShowSQL() bool {
+	return x.showSQL
+}
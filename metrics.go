@@ -0,0 +1,62 @@
+package datasource
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"xorm.io/xorm/contexts"
+)
+
+// 引擎的角色，用于指标的role标签，数据源配置中replica为true时为只读库(见Config.Replica)，否则为主库
+const (
+	RoleMaster  = "master"
+	RoleReplica = "replica"
+)
+
+// 语句的类型，用于指标的operation标签
+const (
+	OperationQuery = "query"
+	OperationExec  = "exec"
+)
+
+// Metrics 数据源的指标接口，Prometheus的实现见metrics包(独立的模块github.com/aluka-7/datasource/metrics，核心包不依赖Prometheus)
+type Metrics interface {
+	// ObserveStatement 记录语句的执行时间
+	ObserveStatement(dsID, role, operation string, duration time.Duration)
+	// IncError 记录执行出错的语句，kind为ErrorKind的分类
+	IncError(dsID, role, operation, kind string)
+	// RegisterPool 注册引擎的连接池，stats在采集指标时调用，同一个dsID和role可以注册多个连接池(如共用数据源的多个租户)，
+	// 采集时合并，引擎关闭后调用返回的unregister注销
+	RegisterPool(dsID, role string, stats func() sql.DBStats) (unregister func())
+}
+
+// WithMetrics 为Orm等方法创建的引擎记录语句的执行时间、错误次数和连接池状态，引擎需要使用Manager.Close关闭以注销连接池
+func WithMetrics(metrics Metrics) Option {
+	return func(d *dataSource) {
+		d.metrics = metrics
+	}
+}
+
+// metricsHook 记录语句的执行时间和错误
+type metricsHook struct {
+	dsID    string
+	role    string
+	metrics Metrics
+}
+
+func (h *metricsHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	return c.Ctx, nil
+}
+
+func (h *metricsHook) AfterProcess(c *contexts.ContextHook) error {
+	operation := OperationExec
+	if isReadStatement(c.SQL) {
+		operation = OperationQuery
+	}
+	h.metrics.ObserveStatement(h.dsID, h.role, operation, c.ExecuteTime)
+	if c.Err != nil && c.Err != sql.ErrNoRows {
+		h.metrics.IncError(h.dsID, h.role, operation, ErrorKind(c.Err))
+	}
+	return nil
+}
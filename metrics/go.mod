@@ -0,0 +1,14 @@
+module github.com/aluka-7/datasource/metrics
+
+go 1.16
+
+require (
+	github.com/aluka-7/configuration v1.0.0
+	github.com/aluka-7/datasource v1.1.0
+	github.com/mattn/go-sqlite3 v1.14.7
+	github.com/prometheus/client_golang v1.12.2
+	github.com/prometheus/client_model v0.2.0
+)
+
+// 本地开发时使用仓库中的datasource，依赖本模块的项目会忽略replace，使用上面要求的datasource版本
+replace github.com/aluka-7/datasource => ../
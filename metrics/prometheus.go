@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var poolLabels = []string{"ds_id", "role"}
+
+/**
+ * datasource.Metrics的Prometheus实现，指标名称以namespace开头:
+ *   {namespace}_sql_duration_seconds    语句执行时间的直方图，标签为ds_id、role、operation
+ *   {namespace}_sql_errors_total        执行出错的语句数，标签为ds_id、role、operation、kind
+ *   {namespace}_sql_pool_*              连接池状态(sql.DBStats)，标签为ds_id、role，采集时读取
+ * 同一个ds_id和role注册了多个连接池时(如共用数据源的多个租户)，连接池指标为各连接池之和。
+ */
+type Prometheus struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	lock     sync.RWMutex
+	pools    map[*pool]struct{}
+
+	maxOpen, open, inUse, idle                          *prometheus.Desc
+	waitCount, waitDuration, idleClosed, lifetimeClosed *prometheus.Desc
+}
+
+// NewPrometheus 创建指标并注册到reg中，测试时可以使用prometheus.NewRegistry()
+func NewPrometheus(reg prometheus.Registerer, namespace string) (*Prometheus, error) {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "sql_pool", name), help, poolLabels, nil)
+	}
+	p := &Prometheus{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sql_duration_seconds",
+			Help:      "SQL语句的执行时间",
+			Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"ds_id", "role", "operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sql_errors_total",
+			Help:      "执行出错的SQL语句数",
+		}, []string{"ds_id", "role", "operation", "kind"}),
+		pools:          make(map[*pool]struct{}),
+		maxOpen:        desc("max_open_connections", "连接池的最大连接数"),
+		open:           desc("open_connections", "已建立的连接数"),
+		inUse:          desc("in_use_connections", "正在使用的连接数"),
+		idle:           desc("idle_connections", "空闲的连接数"),
+		waitCount:      desc("wait_count_total", "等待连接的总次数"),
+		waitDuration:   desc("wait_duration_seconds_total", "等待连接的总时间"),
+		idleClosed:     desc("max_idle_closed_total", "因超过最大空闲数而关闭的连接数"),
+		lifetimeClosed: desc("max_lifetime_closed_total", "因超过最长存活时间而关闭的连接数"),
+	}
+	for _, c := range []prometheus.Collector{p.duration, p.errors, p} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *Prometheus) ObserveStatement(dsID, role, operation string, duration time.Duration) {
+	p.duration.WithLabelValues(dsID, role, operation).Observe(duration.Seconds())
+}
+
+func (p *Prometheus) IncError(dsID, role, operation, kind string) {
+	p.errors.WithLabelValues(dsID, role, operation, kind).Inc()
+}
+
+// pool 一次RegisterPool的注册，按实例区分，注销时删除
+type pool struct {
+	dsID, role string
+	stats      func() sql.DBStats
+}
+
+func (p *Prometheus) RegisterPool(dsID, role string, stats func() sql.DBStats) func() {
+	k := &pool{dsID: dsID, role: role, stats: stats}
+	p.lock.Lock()
+	p.pools[k] = struct{}{}
+	p.lock.Unlock()
+	return func() {
+		p.lock.Lock()
+		delete(p.pools, k)
+		p.lock.Unlock()
+	}
+}
+
+// Describe 实现prometheus.Collector，只描述连接池的指标
+func (p *Prometheus) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{p.maxOpen, p.open, p.inUse, p.idle, p.waitCount, p.waitDuration, p.idleClosed, p.lifetimeClosed} {
+		ch <- d
+	}
+}
+
+// Collect 实现prometheus.Collector，采集时读取各连接池的状态
+func (p *Prometheus) Collect(ch chan<- prometheus.Metric) {
+	p.lock.RLock()
+	sums := make(map[[2]string]sql.DBStats)
+	for k := range p.pools {
+		key := [2]string{k.dsID, k.role}
+		s, sum := k.stats(), sums[key]
+		sum.MaxOpenConnections += s.MaxOpenConnections
+		sum.OpenConnections += s.OpenConnections
+		sum.InUse += s.InUse
+		sum.Idle += s.Idle
+		sum.WaitCount += s.WaitCount
+		sum.WaitDuration += s.WaitDuration
+		sum.MaxIdleClosed += s.MaxIdleClosed
+		sum.MaxLifetimeClosed += s.MaxLifetimeClosed
+		sums[key] = sum
+	}
+	p.lock.RUnlock()
+	for k, s := range sums {
+		gauge := func(d *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v, k[0], k[1])
+		}
+		counter := func(d *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, k[0], k[1])
+		}
+		gauge(p.maxOpen, float64(s.MaxOpenConnections))
+		gauge(p.open, float64(s.OpenConnections))
+		gauge(p.inUse, float64(s.InUse))
+		gauge(p.idle, float64(s.Idle))
+		counter(p.waitCount, float64(s.WaitCount))
+		counter(p.waitDuration, s.WaitDuration.Seconds())
+		counter(p.idleClosed, float64(s.MaxIdleClosed))
+		counter(p.lifetimeClosed, float64(s.MaxLifetimeClosed))
+	}
+}
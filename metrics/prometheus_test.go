@@ -0,0 +1,142 @@
+package metrics_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/aluka-7/configuration"
+	"github.com/aluka-7/configuration/backends"
+	"github.com/aluka-7/datasource"
+	"github.com/aluka-7/datasource/metrics"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestPrometheus(t *testing.T) {
+	cfg := configuration.MockEngine(t, backends.StoreConfig{Exp: map[string]string{
+		"/system/base/datasource/privileges": "{\"1000\":[\"1300\"]}",
+		"/system/base/datasource/common":     "{\"dialect\":\"sqlite3\",\"minPoolSize\":1,\"maxPoolSize\":4}",
+		"/system/base/datasource/1000":       "{\"dsn\":\"file:metrics?mode=memory&cache=shared\"}",
+		"/system/base/datasource/1300":       "{\"dsn\":\"file:metrics?mode=memory&cache=shared\",\"replica\":true}",
+	}})
+	reg := prometheus.NewRegistry()
+	p, err := metrics.NewPrometheus(reg, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := datasource.Engine(cfg, "1000", datasource.WithMetrics(p)).(datasource.Manager)
+	orm, ro := ds.Orm(""), ds.Orm("1300")
+	defer ds.Close(orm)
+	if _, err = orm.Exec("CREATE TABLE item (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = orm.Exec("INSERT INTO item (id) VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = orm.Exec("INSERT INTO item (id) VALUES (1)"); err == nil {
+		t.Fatal("expected duplicate key error")
+	}
+	if _, err = ro.QueryString("SELECT * FROM item"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ro.Exec("DELETE FROM item"); err != datasource.ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	find := func(name string, labels map[string]string) *dto.Metric {
+		for _, f := range families {
+			if f.GetName() != name {
+				continue
+			}
+		next:
+			for _, m := range f.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if v, ok := labels[l.GetName()]; ok && v != l.GetValue() {
+						continue next
+					}
+				}
+				return m
+			}
+		}
+		t.Fatalf("metric %s%v not found", name, labels)
+		return nil
+	}
+	if m := find("test_sql_duration_seconds", map[string]string{"ds_id": "1000", "role": datasource.RoleMaster, "operation": "exec"}); m.GetHistogram().GetSampleCount() != 3 {
+		t.Errorf("expected 3 exec samples, got %d", m.GetHistogram().GetSampleCount())
+	}
+	if m := find("test_sql_duration_seconds", map[string]string{"ds_id": "1300", "role": datasource.RoleReplica, "operation": "query"}); m.GetHistogram().GetSampleCount() != 1 {
+		t.Errorf("expected 1 read-only query sample, got %d", m.GetHistogram().GetSampleCount())
+	}
+	if m := find("test_sql_errors_total", map[string]string{"role": datasource.RoleMaster, "kind": datasource.ErrKindDuplicate}); m.GetCounter().GetValue() != 1 {
+		t.Errorf("expected 1 duplicate error, got %v", m.GetCounter().GetValue())
+	}
+	find("test_sql_errors_total", map[string]string{"ds_id": "1300", "role": datasource.RoleReplica, "kind": datasource.ErrKindReadOnly})
+	if m := find("test_sql_pool_max_open_connections", map[string]string{"role": datasource.RoleMaster}); m.GetGauge().GetValue() != 4 {
+		t.Errorf("expected max open 4, got %v", m.GetGauge().GetValue())
+	}
+	// 关闭的引擎不再计入连接池指标
+	if err = ds.Close(ro); err != nil {
+		t.Fatal(err)
+	}
+	if families, err = reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != "test_sql_pool_max_open_connections" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "role" && l.GetValue() == datasource.RoleReplica {
+					t.Errorf("unexpected pool gauge of closed engine %v", m)
+				}
+			}
+		}
+	}
+	if _, err = metrics.NewPrometheus(reg, "test"); err == nil {
+		t.Error("expected error for duplicate registration")
+	}
+}
+
+func TestPrometheusPools(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	p, err := metrics.NewPrometheus(reg, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := func() sql.DBStats { return sql.DBStats{MaxOpenConnections: 4, InUse: 1} }
+	// 共用数据源的两个租户引擎
+	unregister1 := p.RegisterPool("1000", datasource.RoleMaster, stats)
+	unregister2 := p.RegisterPool("1000", datasource.RoleMaster, stats)
+	maxOpen := func() []float64 {
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var values []float64
+		for _, f := range families {
+			if f.GetName() == "test_sql_pool_max_open_connections" {
+				for _, m := range f.GetMetric() {
+					values = append(values, m.GetGauge().GetValue())
+				}
+			}
+		}
+		return values
+	}
+	if v := maxOpen(); len(v) != 1 || v[0] != 8 {
+		t.Errorf("expected one summed gauge 8, got %v", v)
+	}
+	unregister1()
+	if v := maxOpen(); len(v) != 1 || v[0] != 4 {
+		t.Errorf("expected 4 after unregister, got %v", v)
+	}
+	unregister2()
+	if v := maxOpen(); len(v) != 0 {
+		t.Errorf("expected no gauge after unregister, got %v", v)
+	}
+}
@@ -0,0 +1,203 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aluka-7/datasource/sort"
+	"xorm.io/builder"
+)
+
+// AggregateFunc 聚合函数
+type AggregateFunc int
+
+const (
+	COUNT AggregateFunc = iota + 1
+	CountDistinct
+	SUM
+	AVG
+	MIN
+	MAX
+)
+
+// Bucket 时间字段的分组粒度，分组值为对应格式的字符串，如Day为"2021-06-01"
+type Bucket int
+
+const (
+	NoBucket Bucket = iota
+	Hour            // 2021-06-01 08
+	Day             // 2021-06-01
+	Month           // 2021-06
+	Year            // 2021
+)
+
+var bucketFormats = []string{"", "%Y-%m-%d %H", "%Y-%m-%d", "%Y-%m", "%Y"}
+
+// 结果列的别名只允许字母、数字和下划线
+var aliasPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// GroupBy 分组字段，Id为字段映射中的id，As为结果中的列名(默认为Id)，Bucket只用于TypeUnix和TypeTime类型的字段
+type GroupBy struct {
+	Id     string
+	As     string
+	Bucket Bucket
+}
+
+// Aggregate 聚合项，Id为字段映射中的id(COUNT时可以为空，表示COUNT(*))，As为结果中的列名(COUNT时默认为count)
+type Aggregate struct {
+	Func AggregateFunc
+	Id   string
+	As   string
+}
+
+func (g GroupBy) alias() string {
+	if len(g.As) > 0 {
+		return g.As
+	}
+	return g.Id
+}
+
+// Expr 生成分组字段的SQL表达式
+func (g GroupBy) Expr(column map[string]Filter, dialect string) (string, error) {
+	k, err := aggregateColumn(column, g.Id, g.alias())
+	if err != nil {
+		return "", err
+	}
+	if g.Bucket == NoBucket {
+		return k.FieldName, nil
+	}
+	if g.Bucket < 0 || int(g.Bucket) >= len(bucketFormats) {
+		return "", fmt.Errorf("分组字段[%s]的时间粒度不合法", g.Id)
+	}
+	if k.Type != TypeUnix && k.Type != TypeTime {
+		return "", fmt.Errorf("分组字段[%s]不是时间类型，不能按时间粒度分组", g.Id)
+	}
+	format := bucketFormats[g.Bucket]
+	unix := k.Type == TypeUnix
+	switch dialect {
+	case builder.MYSQL:
+		if unix {
+			return fmt.Sprintf("DATE_FORMAT(FROM_UNIXTIME(%s), '%s')", k.FieldName, format), nil
+		}
+		return fmt.Sprintf("DATE_FORMAT(%s, '%s')", k.FieldName, format), nil
+	case builder.SQLITE:
+		if unix {
+			return fmt.Sprintf("strftime('%s', %s, 'unixepoch', 'localtime')", format, k.FieldName), nil
+		}
+		return fmt.Sprintf("strftime('%s', %s)", format, k.FieldName), nil
+	case builder.POSTGRES:
+		format = strings.NewReplacer("%Y", "YYYY", "%m", "MM", "%d", "DD", "%H", "HH24").Replace(format)
+		if unix {
+			return fmt.Sprintf("to_char(to_timestamp(%s), '%s')", k.FieldName, format), nil
+		}
+		return fmt.Sprintf("to_char(%s, '%s')", k.FieldName, format), nil
+	}
+	return "", fmt.Errorf("数据库[%s]不支持按时间粒度分组", dialect)
+}
+
+func (a Aggregate) alias() string {
+	if len(a.As) == 0 && a.Func == COUNT {
+		return "count"
+	}
+	return a.As
+}
+
+// Expr 生成聚合项的SQL表达式
+func (a Aggregate) Expr(column map[string]Filter) (string, error) {
+	if len(a.Id) == 0 && a.Func == COUNT {
+		if !aliasPattern.MatchString(a.alias()) {
+			return "", fmt.Errorf("聚合项的列名[%s]不合法", a.alias())
+		}
+		return "COUNT(*)", nil
+	}
+	k, err := aggregateColumn(column, a.Id, a.alias())
+	if err != nil {
+		return "", err
+	}
+	switch a.Func {
+	case COUNT:
+		return "COUNT(" + k.FieldName + ")", nil
+	case CountDistinct:
+		return "COUNT(DISTINCT " + k.FieldName + ")", nil
+	case SUM:
+		return "SUM(" + k.FieldName + ")", nil
+	case AVG:
+		return "AVG(" + k.FieldName + ")", nil
+	case MIN:
+		return "MIN(" + k.FieldName + ")", nil
+	case MAX:
+		return "MAX(" + k.FieldName + ")", nil
+	}
+	return "", fmt.Errorf("聚合项[%s]的聚合函数不合法", a.Id)
+}
+
+func aggregateColumn(column map[string]Filter, id, alias string) (Filter, error) {
+	k, ok := column[id]
+	if !ok {
+		return k, fmt.Errorf("字段[%s]不存在", id)
+	}
+	if k.Join != nil && k.Join.Many {
+		return k, fmt.Errorf("字段[%s]属于一对多关联，不能用于分组或聚合", id)
+	}
+	if !aliasPattern.MatchString(alias) {
+		return k, fmt.Errorf("字段[%s]的列名[%s]不合法", id, alias)
+	}
+	return k, nil
+}
+
+/**
+ * 生成分组统计的SELECT、GROUP BY和ORDER BY语句，结果列名为GroupBy和Aggregate的As，
+ * sp.Sorted中的id为结果列名时按该列排序，否则按分组字段的顺序排序。
+ */
+func (sp Query) MarkAggregate(column map[string]Filter, dialect string, groupBy []GroupBy, aggregates []Aggregate) (selects, groups []string, order *sort.Sort, err error) {
+	aliases := make(map[string]bool)
+	groupAliases := make([]string, 0, len(groupBy))
+	for _, v := range groupBy {
+		expr, err := v.Expr(column, dialect)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		selects = append(selects, expr+" AS "+v.alias())
+		groups = append(groups, expr)
+		groupAliases = append(groupAliases, v.alias())
+		aliases[v.alias()] = true
+	}
+	for _, v := range aggregates {
+		expr, err := v.Expr(column)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		selects = append(selects, expr+" AS "+v.alias())
+		aliases[v.alias()] = true
+	}
+	order = sort.Sorted()
+	for _, v := range sp.Sorted {
+		if !aliases[v.Id] {
+			continue
+		}
+		if v.Desc {
+			order.Desc(v.Id)
+		} else {
+			order.Asc(v.Id)
+		}
+	}
+	if len(order.Orders()) == 0 {
+		order.ByProperties(sort.ASC, groupAliases...)
+	}
+	return
+}
+
+// AggregateIds 分组和聚合使用到的字段id，用于MarkJoins添加关联表
+func AggregateIds(groupBy []GroupBy, aggregates []Aggregate) []string {
+	ids := make([]string, 0, len(groupBy)+len(aggregates))
+	for _, v := range groupBy {
+		ids = append(ids, v.Id)
+	}
+	for _, v := range aggregates {
+		if len(v.Id) > 0 {
+			ids = append(ids, v.Id)
+		}
+	}
+	return ids
+}
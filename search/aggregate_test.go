@@ -0,0 +1,107 @@
+package search_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aluka-7/common"
+	"github.com/aluka-7/datasource/base"
+	"github.com/aluka-7/datasource/search"
+	_ "github.com/mattn/go-sqlite3"
+	"xorm.io/builder"
+	"xorm.io/xorm"
+)
+
+type payment struct {
+	base.Entity `xorm:"extends"`
+	Status      string `search:"status"`
+	Amount      int64  `search:"amount,op=gte,type=int"`
+}
+
+type paymentStat struct {
+	Day    string
+	Status string
+	Count  int64
+	Total  int64
+	Max    int64
+}
+
+func TestMarkAggregate(t *testing.T) {
+	column := map[string]search.Filter{
+		"createTime": {FieldName: "create_time", Type: search.TypeUnix},
+		"amount":     {FieldName: "amount"},
+	}
+	query := search.Query{}
+	selects, groups, order, err := query.MarkAggregate(column, builder.MYSQL,
+		[]search.GroupBy{{Id: "createTime", As: "day", Bucket: search.Day}},
+		[]search.Aggregate{{Func: search.COUNT}, {Func: search.SUM, Id: "amount", As: "total"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "DATE_FORMAT(FROM_UNIXTIME(create_time), '%Y-%m-%d') AS day,COUNT(*) AS count,SUM(amount) AS total"
+	if actual := strings.Join(selects, ","); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if len(groups) != 1 || order.ToSql(builder.MYSQL) != "day ASC" {
+		t.Errorf("unexpected group by %v order by %s", groups, order.ToSql(builder.MYSQL))
+	}
+	if _, _, _, err = query.MarkAggregate(column, builder.MYSQL, []search.GroupBy{{Id: "amount", Bucket: search.Day}}, nil); err == nil {
+		t.Error("expected error for bucket on non-time column")
+	}
+	if _, _, _, err = query.MarkAggregate(column, builder.MYSQL, nil, []search.Aggregate{{Func: search.SUM, Id: "amount", As: "x;drop"}}); err == nil {
+		t.Error("expected error for invalid alias")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	orm, err := xorm.NewEngine("sqlite3", "file:aggregate?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orm.Close()
+	if err = orm.Sync2(new(payment)); err != nil {
+		t.Fatal(err)
+	}
+	day1 := time.Date(2021, 6, 1, 10, 0, 0, 0, time.Local).Unix()
+	day2 := time.Date(2021, 6, 2, 10, 0, 0, 0, time.Local).Unix()
+	payments := []payment{
+		{Entity: base.Entity{CreateTime: day1}, Status: "A", Amount: 10},
+		{Entity: base.Entity{CreateTime: day1 + 60}, Status: "A", Amount: 20},
+		{Entity: base.Entity{CreateTime: day1}, Status: "D", Amount: 5},
+		{Entity: base.Entity{CreateTime: day2}, Status: "A", Amount: 30},
+		{Entity: base.Entity{CreateTime: day2}, Status: "A", Amount: 1},
+	}
+	if _, err = orm.Insert(payments); err != nil {
+		t.Fatal(err)
+	}
+	column, err := search.Columns(orm, new(payment))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := base.NewBaseRepository(orm, []*xorm.Engine{orm}, column)
+	query := common.Query{}
+	query.SetFiltered("amount", 5)
+	query.SetSorted("total", true)
+	var rows []paymentStat
+	err = repo.Aggregate(context.Background(), query, new(payment),
+		[]search.GroupBy{{Id: "createTime", As: "day", Bucket: search.Day}, {Id: "status"}},
+		[]search.Aggregate{{Func: search.COUNT}, {Func: search.SUM, Id: "amount", As: "total"}, {Func: search.MAX, Id: "amount", As: "max"}}, &rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []paymentStat{
+		{Day: "2021-06-01", Status: "A", Count: 2, Total: 30, Max: 20},
+		{Day: "2021-06-02", Status: "A", Count: 1, Total: 30, Max: 30},
+		{Day: "2021-06-01", Status: "D", Count: 1, Total: 5, Max: 5},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, rows)
+	}
+	for i, v := range expected {
+		if rows[i] != v && !(i < 2 && rows[1-i] == v) {
+			t.Errorf("expected %+v, got %+v", expected, rows)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package search
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"xorm.io/xorm"
+)
+
+var valueTypeNames = []string{"", "string", "int", "float", "bool", "time", "unix", "enum"}
+
+func ValueTypeOf(valueType string) ValueType {
+	for i, v := range valueTypeNames {
+		if i > 0 && strings.EqualFold(v, valueType) {
+			return ValueType(i)
+		}
+	}
+	return TypeAny
+}
+
+/**
+ * 根据实体的search标签生成查询使用的字段映射，字段名使用engine的映射规则(与Orm中配置的SnakeMapper一致)，
+ * 支持xorm:"extends"嵌入的结构体(如base.Entity)，标签格式为:
+ *   search:"email,op=like,sortable,type=int,enum=A|B"
+ * 第一部分为查询中使用的id，为空时使用首字母小写的字段名；op为操作符(不区分大小写，默认EQ)；
+ * sortable表示允许按该字段排序；type为值类型；enum为枚举的可选值。没有search标签或标签为"-"的字段会被忽略。
+ */
+func Columns(engine *xorm.Engine, bean interface{}) (map[string]Filter, error) {
+	table, err := engine.TableInfo(bean)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(table.Columns()))
+	for _, col := range table.Columns() {
+		names[col.FieldName] = col.Name
+	}
+	column := make(map[string]Filter)
+	t := reflect.Indirect(reflect.ValueOf(bean)).Type()
+	if err = columns(t, "", names, column); err != nil {
+		return nil, err
+	}
+	return column, nil
+}
+
+func columns(t reflect.Type, prefix string, names map[string]string, column map[string]Filter) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldName := prefix + field.Name
+		tag, tagged := field.Tag.Lookup("search")
+		if tag == "-" {
+			continue
+		}
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if !tagged && ft.Kind() == reflect.Struct && (field.Anonymous || strings.Contains(field.Tag.Get("xorm"), "extends")) {
+			if err := columns(ft, fieldName+".", names, column); err != nil {
+				return err
+			}
+			continue
+		}
+		if !tagged {
+			continue
+		}
+		name, ok := names[fieldName]
+		if !ok {
+			return fmt.Errorf("字段[%s]不是数据库列", fieldName)
+		}
+		id, filter, err := parseTag(tag, field.Name)
+		if err != nil {
+			return fmt.Errorf("字段[%s]的search标签不合法:%v", fieldName, err)
+		}
+		filter.FieldName = name
+		column[id] = filter
+	}
+	return nil
+}
+
+func parseTag(tag, fieldName string) (id string, filter Filter, err error) {
+	parts := strings.Split(tag, ",")
+	id = strings.TrimSpace(parts[0])
+	if len(id) == 0 {
+		id = strings.ToLower(fieldName[:1]) + fieldName[1:]
+	}
+	filter = Filter{Operator: EQ, NoSort: true}
+	for _, v := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(v), "=", 2)
+		switch strings.ToLower(kv[0]) {
+		case "sortable":
+			filter.NoSort = false
+		case "op":
+			if len(kv) != 2 {
+				return "", filter, fmt.Errorf("op未指定操作符")
+			}
+			if filter.Operator = operatorValueOfFold(kv[1]); filter.Operator == 0 {
+				return "", filter, fmt.Errorf("未知的操作符[%s]", kv[1])
+			}
+		case "type":
+			if len(kv) != 2 {
+				return "", filter, fmt.Errorf("type未指定类型")
+			}
+			if filter.Type = ValueTypeOf(kv[1]); filter.Type == TypeAny {
+				return "", filter, fmt.Errorf("未知的类型[%s]", kv[1])
+			}
+		case "enum":
+			if len(kv) != 2 {
+				return "", filter, fmt.Errorf("enum未指定可选值")
+			}
+			filter.Type = TypeEnum
+			filter.Enum = strings.Split(kv[1], "|")
+		case "":
+		default:
+			return "", filter, fmt.Errorf("未知的选项[%s]", v)
+		}
+	}
+	return
+}
@@ -0,0 +1,73 @@
+package search_test
+
+import (
+	"testing"
+
+	"github.com/aluka-7/datasource/base"
+	"github.com/aluka-7/datasource/search"
+	_ "github.com/mattn/go-sqlite3"
+	"xorm.io/xorm"
+	"xorm.io/xorm/names"
+)
+
+type account struct {
+	base.Entity `xorm:"extends"`
+	Email       string `xorm:"varchar(100)" search:"email,op=like,sortable"`
+	LoginName   string `xorm:"varchar(25)" search:",op=startsWith"`
+	Status      string `xorm:"'state' varchar(1)" search:"status,op=in,enum=A|D"`
+	Password    string `xorm:"varchar(16)"`
+	Secret      string `xorm:"varchar(16)" search:"-"`
+}
+
+func TestColumns(t *testing.T) {
+	orm, err := xorm.NewEngine("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orm.Close()
+	orm.SetTableMapper(names.NewPrefixMapper(names.SnakeMapper{}, "os_1000_"))
+	column, err := search.Columns(orm, new(account))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]search.Filter{
+		"id":         {FieldName: "id", Operator: search.IN, Type: search.TypeInt},
+		"createTime": {FieldName: "create_time", Operator: search.BETWEEN, Type: search.TypeUnix},
+		"email":      {FieldName: "email", Operator: search.LIKE},
+		"loginName":  {FieldName: "login_name", Operator: search.StartsWith, NoSort: true},
+		"status":     {FieldName: "state", Operator: search.IN, Type: search.TypeEnum, NoSort: true},
+	}
+	for id, expected := range tests {
+		actual, ok := column[id]
+		if !ok {
+			t.Errorf("%s: missing", id)
+			continue
+		}
+		if actual.FieldName != expected.FieldName || actual.Operator != expected.Operator || actual.Type != expected.Type || actual.NoSort != expected.NoSort {
+			t.Errorf("%s: expected %+v, got %+v", id, expected, actual)
+		}
+	}
+	if len(column["status"].Enum) != 2 {
+		t.Errorf("status: expected enum [A D], got %v", column["status"].Enum)
+	}
+	for _, id := range []string{"password", "secret"} {
+		if _, ok := column[id]; ok {
+			t.Errorf("%s: should be ignored", id)
+		}
+	}
+}
+
+func TestColumnsInvalidTag(t *testing.T) {
+	orm, err := xorm.NewEngine("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orm.Close()
+	type invalid struct {
+		Id   int64
+		Name string `search:"name,op=unknown"`
+	}
+	if _, err = search.Columns(orm, new(invalid)); err == nil {
+		t.Error("expected error for unknown operator")
+	}
+}
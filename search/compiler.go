@@ -0,0 +1,130 @@
+package search
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"xorm.io/builder"
+)
+
+// CondFunc 根据字段名、转换后的值和数据库类型(如mysql、sqlite3，未知时为空)生成查询条件
+type CondFunc func(fieldName string, value interface{}, dialect string) builder.Cond
+
+// Arity 操作符需要的值的形式，决定客户端传入的值如何转换后再交给CondFunc
+type Arity int
+
+const (
+	Single   Arity = iota // 单个值，按照Filter.Type转换
+	Multiple              // 多个值，接受逗号分隔的字符串或数组，每个值按照Filter.Type转换，CondFunc收到[]interface{}
+	Pair                  // 两个值，同Multiple但必须恰好两个
+	Text                  // 单个字符串，数字等标量会被转换为字符串，CondFunc收到string
+	NoValue               // 不需要值，CondFunc收到nil
+)
+
+type operatorCompiler struct {
+	arity Arity
+	cond  CondFunc
+}
+
+var compilers = map[Operator]operatorCompiler{
+	EQ:         {Single, func(f string, v interface{}, _ string) builder.Cond { return builder.Eq{f: v} }},
+	NE:         {Single, func(f string, v interface{}, _ string) builder.Cond { return builder.Neq{f: v} }},
+	GT:         {Single, func(f string, v interface{}, _ string) builder.Cond { return builder.Gt{f: v} }},
+	LT:         {Single, func(f string, v interface{}, _ string) builder.Cond { return builder.Lt{f: v} }},
+	GTE:        {Single, func(f string, v interface{}, _ string) builder.Cond { return builder.Gte{f: v} }},
+	LTE:        {Single, func(f string, v interface{}, _ string) builder.Cond { return builder.Lte{f: v} }},
+	IN:         {Multiple, func(f string, v interface{}, _ string) builder.Cond { return builder.In(f, v) }},
+	NI:         {Multiple, func(f string, v interface{}, _ string) builder.Cond { return builder.NotIn(f, v) }},
+	IsNull:     {NoValue, func(f string, _ interface{}, _ string) builder.Cond { return builder.IsNull{f} }},
+	NotNull:    {NoValue, func(f string, _ interface{}, _ string) builder.Cond { return builder.NotNull{f} }},
+	BETWEEN:    {Pair, func(f string, v interface{}, _ string) builder.Cond { return markBetween(f, v) }},
+	NotBetween: {Pair, func(f string, v interface{}, _ string) builder.Cond { return builder.Not{markBetween(f, v)} }},
+	LIKE:       {Text, func(f string, v interface{}, _ string) builder.Cond { return builder.Like{f, v.(string)} }},
+	NotLike:    {Text, func(f string, v interface{}, _ string) builder.Cond { return builder.Not{builder.Like{f, v.(string)}} }},
+	StartsWith: {Text, func(f string, v interface{}, _ string) builder.Cond { return markLike(f, escapeLike(v.(string))+"%") }},
+	EndsWith:   {Text, func(f string, v interface{}, _ string) builder.Cond { return markLike(f, "%"+escapeLike(v.(string))) }},
+	Contains: {Text, func(f string, v interface{}, _ string) builder.Cond {
+		return markLike(f, "%"+escapeLike(v.(string))+"%")
+	}},
+	ILIKE:        {Text, markILike},
+	MATCH:        {Text, markMatch},
+	JsonEQ:       {Single, jsonEQ},
+	JsonContains: {Single, jsonContains},
+	JsonHasKey:   {Single, jsonHasKey},
+}
+
+// Cond 使用给定的值编译当前过滤条件，Operator为0时视为EQ，值无法按照Type转换时返回错误
+func (k Filter) Cond(value interface{}, dialect string) (builder.Cond, error) {
+	operator := k.Operator
+	if operator == 0 {
+		operator = EQ
+	}
+	c, ok := compilerOf(operator)
+	if !ok {
+		return nil, fmt.Errorf("未知的操作符[%d]", operator)
+	}
+	value, err := markValue(c.arity, k, value)
+	if err != nil {
+		return nil, err
+	}
+	if k.Join != nil && k.Join.Many {
+		return k.Join.exists(c.cond(k.FieldName, value, dialect))
+	}
+	return c.cond(k.FieldName, value, dialect), nil
+}
+
+// Compile 将使用自身Value的过滤条件(如Parse的结果)编译为builder.Cond，多个条件之间使用AND连接，
+// 不合法的过滤条件会以ValidationError返回
+func Compile(filters []Filter, dialect string) (builder.Cond, error) {
+	conds := make([]builder.Cond, 0, len(filters))
+	var errs ValidationError
+	for _, filter := range filters {
+		cond, err := filter.Cond(filter.Value, dialect)
+		if err != nil {
+			errs = append(errs, FilterError{Id: filter.FieldName, Value: filter.Value, Reason: err.Error()})
+			continue
+		}
+		conds = append(conds, cond)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return builder.And(conds...), nil
+}
+
+func markBetween(fieldName string, value interface{}) builder.Cond {
+	rv := reflect.ValueOf(value)
+	return builder.Between{Col: fieldName, LessVal: rv.Index(0).Interface(), MoreVal: rv.Index(1).Interface()}
+}
+
+// likeEscape LIKE语句的转义字符，使用'!'而不是'\'以避免不同数据库对反斜杠的处理差异
+const likeEscape = "!"
+
+var likeReplacer = strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_")
+
+func escapeLike(value string) string {
+	return likeReplacer.Replace(value)
+}
+func markLike(fieldName, pattern string) builder.Cond {
+	return builder.Expr(fieldName+" LIKE ? ESCAPE '"+likeEscape+"'", pattern)
+}
+func markILike(fieldName string, v interface{}, dialect string) builder.Cond {
+	value := v.(string)
+	if len(value) == 0 {
+		return builder.NewCond()
+	}
+	if value[0] != '%' && value[len(value)-1] != '%' {
+		value = "%" + value + "%"
+	}
+	if dialect == builder.POSTGRES {
+		return builder.Expr(fieldName+" ILIKE ?", value)
+	}
+	return builder.Expr("LOWER("+fieldName+") LIKE LOWER(?)", value)
+}
+func toString(value interface{}) string {
+	if vs, ok := value.(string); ok {
+		return vs
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,111 @@
+package search
+
+import (
+	"xorm.io/builder"
+)
+
+/**
+ * 过滤表达式，兼容原有的{"id":"email","value":"x"}格式，并支持嵌套的AND/OR/NOT分组，如:
+ * {"filtered":[{"or":[{"id":"status","value":"A"},{"and":[{"id":"owner","value":1},{"id":"draft","value":true}]}]}]}
+ * 对应的条件为: status = 'A' OR (owner = 1 AND draft = true)
+ */
+type Expression struct {
+	Id    string       `json:"id,omitempty"`
+	Value interface{}  `json:"value,omitempty"`
+	And   []Expression `json:"and,omitempty"`
+	Or    []Expression `json:"or,omitempty"`
+	Not   *Expression  `json:"not,omitempty"`
+}
+
+func Leaf(id string, value interface{}) Expression {
+	return Expression{Id: id, Value: value}
+}
+func And(expressions ...Expression) Expression {
+	return Expression{And: expressions}
+}
+func Or(expressions ...Expression) Expression {
+	return Expression{Or: expressions}
+}
+func Not(expression Expression) Expression {
+	return Expression{Not: &expression}
+}
+
+// IsGroup 是否为AND/OR/NOT分组节点
+func (e Expression) IsGroup() bool {
+	return len(e.And) > 0 || len(e.Or) > 0 || e.Not != nil
+}
+
+// walk 依次访问表达式中所有叶子节点的id
+func (e Expression) walk(fn func(id string)) {
+	if !e.IsGroup() {
+		fn(e.Id)
+		return
+	}
+	for _, v := range e.And {
+		v.walk(fn)
+	}
+	for _, v := range e.Or {
+		v.walk(fn)
+	}
+	if e.Not != nil {
+		e.Not.walk(fn)
+	}
+}
+
+// Cond 将表达式转换为builder.Cond，column中不存在的id会被忽略，可同时用于xorm.Session和builder.Builder，
+// 值无法按照Filter.Type转换时返回ValidationError，其中包含所有不合法的过滤条件
+func (e Expression) Cond(column map[string]Filter, dialect string) (builder.Cond, error) {
+	var errs ValidationError
+	cond := e.cond(column, dialect, &errs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return cond, nil
+}
+func (e Expression) cond(column map[string]Filter, dialect string, errs *ValidationError) builder.Cond {
+	if !e.IsGroup() {
+		if k, ok := column[e.Id]; ok {
+			cond, err := k.Cond(e.Value, dialect)
+			if err != nil {
+				*errs = append(*errs, FilterError{Id: e.Id, Value: e.Value, Reason: err.Error()})
+				return builder.NewCond()
+			}
+			return cond
+		}
+		return builder.NewCond()
+	}
+	var cs []builder.Cond
+	if len(e.And) > 0 {
+		cs = append(cs, conds(e.And, column, dialect, errs))
+	}
+	if len(e.Or) > 0 {
+		or := make([]builder.Cond, 0, len(e.Or))
+		for _, v := range e.Or {
+			or = append(or, v.cond(column, dialect, errs))
+		}
+		cs = append(cs, builder.Or(or...))
+	}
+	if e.Not != nil {
+		if cond := e.Not.cond(column, dialect, errs); cond.IsValid() {
+			cs = append(cs, builder.Not{cond})
+		}
+	}
+	return builder.And(cs...)
+}
+
+// Conds 将多个表达式以AND连接后转换为builder.Cond
+func Conds(expressions []Expression, column map[string]Filter, dialect string) (builder.Cond, error) {
+	var errs ValidationError
+	cond := conds(expressions, column, dialect, &errs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return cond, nil
+}
+func conds(expressions []Expression, column map[string]Filter, dialect string, errs *ValidationError) builder.Cond {
+	cs := make([]builder.Cond, 0, len(expressions))
+	for _, v := range expressions {
+		cs = append(cs, v.cond(column, dialect, errs))
+	}
+	return builder.And(cs...)
+}
@@ -0,0 +1,63 @@
+package search
+
+import (
+	"strings"
+
+	"xorm.io/builder"
+)
+
+// FullTextRowId sqlite3的FTS5虚拟表通过该列关联原表，与base.Entity的主键一致
+const FullTextRowId = "id"
+
+// FullTextTable 表在sqlite3中对应的FTS5虚拟表名
+func FullTextTable(table string) string {
+	return table + "_fts"
+}
+
+// FullTextField 生成MATCH操作符使用的字段名，格式为"table.col1,table.col2"，sqlite3需要通过表名找到FTS5虚拟表
+func FullTextField(table string, columns ...string) string {
+	fields := make([]string, len(columns))
+	for i, v := range columns {
+		fields[i] = table + "." + v
+	}
+	return strings.Join(fields, ",")
+}
+
+// markMatch 客户端的值按空白拆分为多个词，所有的词都必须匹配
+func markMatch(fieldName string, v interface{}, dialect string) builder.Cond {
+	terms := strings.Fields(strings.ReplaceAll(v.(string), `"`, " "))
+	if len(terms) == 0 {
+		return builder.NewCond()
+	}
+	fields := strings.Split(fieldName, ",")
+	switch dialect {
+	case builder.MYSQL:
+		return builder.Expr("MATCH("+fieldName+") AGAINST(? IN BOOLEAN MODE)", `+"`+strings.Join(terms, `" +"`)+`"`)
+	case builder.SQLITE:
+		var table string
+		columns := make([]string, len(fields))
+		for i, v := range fields {
+			if idx := strings.LastIndex(v, "."); idx > 0 {
+				table, columns[i] = v[:idx], v[idx+1:]
+			} else {
+				columns[i] = v
+			}
+		}
+		if len(table) == 0 {
+			return builder.Expr("1=0")
+		}
+		fts := FullTextTable(table)
+		query := "{" + strings.Join(columns, " ") + `} : ("` + strings.Join(terms, `" AND "`) + `")`
+		return builder.Expr(table+"."+FullTextRowId+" IN (SELECT rowid FROM "+fts+" WHERE "+fts+" MATCH ?)", query)
+	default:
+		conds := make([]builder.Cond, len(terms))
+		for i, term := range terms {
+			or := make([]builder.Cond, len(fields))
+			for j, field := range fields {
+				or[j] = markLike(field, "%"+escapeLike(term)+"%")
+			}
+			conds[i] = builder.Or(or...)
+		}
+		return builder.And(conds...)
+	}
+}
@@ -0,0 +1,109 @@
+package search
+
+import (
+	"strings"
+
+	"xorm.io/builder"
+	"xorm.io/xorm"
+)
+
+/**
+ * 字段所属的关联表，字段映射中的FieldName需要使用别名限定，如:
+ *   "customerEmail": {FieldName: "c.email", Operator: search.EQ, Join: &search.Join{Table: "os_customer", Alias: "c", On: "c.id = os_order.customer_id"}}
+ * 一对一(多对一)关联在按该字段过滤或排序时添加一次JOIN；一对多关联使用EXISTS子查询，避免主表出现重复行，且不能用于排序。
+ */
+type Join struct {
+	Table string // 关联表名
+	Alias string // 别名，为空时使用表名
+	On    string // 关联条件
+	Type  string // JOIN类型，默认为LEFT
+	Many  bool   // 是否为一对多关联
+}
+
+func (j *Join) alias() string {
+	if len(j.Alias) > 0 {
+		return j.Alias
+	}
+	return j.Table
+}
+func (j *Join) joinType() string {
+	if len(j.Type) > 0 {
+		return j.Type
+	}
+	return "LEFT"
+}
+
+// exists 将一对多关联字段上的条件转换为EXISTS子查询
+func (j *Join) exists(cond builder.Cond) (builder.Cond, error) {
+	if !cond.IsValid() {
+		return cond, nil
+	}
+	sql, args, err := builder.ToSQL(cond)
+	if err != nil {
+		return nil, err
+	}
+	from := j.Table
+	if len(j.Alias) > 0 {
+		from += " " + j.Alias
+	}
+	return builder.Expr("EXISTS (SELECT 1 FROM "+from+" WHERE "+j.On+" AND ("+sql+"))", args...), nil
+}
+
+// MarkJoins 返回过滤、排序以及ids(如分组和聚合字段)使用到的一对一关联，按别名去重，一对多关联使用EXISTS子查询，不在其中
+func (sp Query) MarkJoins(column map[string]Filter, ids ...string) (joins []*Join) {
+	added := make(map[string]bool)
+	mark := func(id string) {
+		if k, ok := column[id]; ok && k.Join != nil && !k.Join.Many && !added[k.Join.alias()] {
+			added[k.Join.alias()] = true
+			joins = append(joins, k.Join)
+		}
+	}
+	for _, v := range sp.expressions() {
+		v.walk(mark)
+	}
+	for _, v := range sp.Sorted {
+		mark(v.Id)
+	}
+	for _, v := range ids {
+		mark(v)
+	}
+	return
+}
+
+/**
+ * 过滤、排序或ids使用到一对一关联时，返回主表字段使用table(已转义的表名)限定的字段映射，避免与关联表中的同名列(如id)冲突，
+ * 只限定FieldName为单个列名的字段(如Columns生成的字段)，已限定的字段和表达式保持不变；没有关联时返回column。
+ */
+func (sp Query) Qualified(column map[string]Filter, table string, ids ...string) map[string]Filter {
+	if len(sp.MarkJoins(column, ids...)) == 0 {
+		return column
+	}
+	qualified := make(map[string]Filter, len(column))
+	for id, k := range column {
+		if k.Join == nil && isColumnName(k.FieldName) {
+			k.FieldName = table + "." + k.FieldName
+		}
+		qualified[id] = k
+	}
+	return qualified
+}
+
+func isColumnName(name string) bool {
+	return len(name) > 0 && strings.IndexFunc(name, func(r rune) bool {
+		return !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	}) < 0
+}
+
+// MarkOrmJoined 将过滤和排序使用到的关联表添加到session中，需要与MarkOrmFiltered、MarkOrder一起使用
+func (sp Query) MarkOrmJoined(column map[string]Filter, orm *xorm.Session, ids ...string) {
+	for _, v := range sp.MarkJoins(column, ids...) {
+		orm.Join(v.joinType(), []string{v.Table, v.alias()}, v.On)
+	}
+}
+
+// MarkSqlJoined 与MarkOrmJoined相同，用于builder.Builder
+func (sp Query) MarkSqlJoined(column map[string]Filter, bu *builder.Builder, ids ...string) {
+	for _, v := range sp.MarkJoins(column, ids...) {
+		bu.Join(v.joinType(), v.Table+" "+v.alias(), v.On)
+	}
+}
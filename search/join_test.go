@@ -0,0 +1,131 @@
+package search_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aluka-7/common"
+	"github.com/aluka-7/datasource/base"
+	"github.com/aluka-7/datasource/search"
+	_ "github.com/mattn/go-sqlite3"
+	"xorm.io/xorm"
+)
+
+type customer struct {
+	Id    int64
+	Email string
+}
+
+type order struct {
+	Id         int64
+	CustomerId int64
+	Amount     int64
+}
+
+type orderItem struct {
+	Id      int64
+	OrderId int64
+	Sku     string
+}
+
+func TestQueryJoins(t *testing.T) {
+	orm, err := xorm.NewEngine("sqlite3", "file:join?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orm.Close()
+	if err = orm.Sync2(new(customer), new(order), new(orderItem)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = orm.Insert([]customer{{Email: "a@xxxx.cn"}, {Email: "b@xxxx.cn"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = orm.Insert([]order{{CustomerId: 1, Amount: 10}, {CustomerId: 1, Amount: 20}, {CustomerId: 2, Amount: 30}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = orm.Insert([]orderItem{{OrderId: 1, Sku: "x"}, {OrderId: 1, Sku: "x"}, {OrderId: 2, Sku: "y"}, {OrderId: 3, Sku: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	customerJoin := &search.Join{Table: "customer", Alias: "c", On: "c.id = `order`.customer_id"}
+	repo := base.NewBaseRepository(orm, []*xorm.Engine{orm}, map[string]search.Filter{
+		"amount":        {FieldName: "`order`.amount", Operator: search.GTE},
+		"customerEmail": {FieldName: "c.email", Operator: search.EQ, Join: customerJoin},
+		"customerId":    {FieldName: "c.id", Operator: search.EQ, Join: customerJoin},
+		"sku":           {FieldName: "i.sku", Operator: search.EQ, Join: &search.Join{Table: "order_item", Alias: "i", On: "i.order_id = `order`.id", Many: true}},
+	})
+	tests := []struct {
+		query    common.Query
+		expected []int64
+	}{
+		{query(map[string]interface{}{"customerEmail": "a@xxxx.cn"}, "amount"), []int64{1, 2}},
+		{query(map[string]interface{}{"customerEmail": "a@xxxx.cn", "customerId": 1}, "customerEmail"), []int64{1, 2}},
+		{query(map[string]interface{}{"sku": "x"}, "amount"), []int64{1, 3}},
+		{query(map[string]interface{}{"sku": "x", "customerEmail": "b@xxxx.cn"}, "sku"), []int64{3}},
+	}
+	for i, v := range tests {
+		var list []order
+		page, err := repo.Query(context.Background(), v.query, &list, new(order))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.TotalRecords != len(v.expected) || len(list) != len(v.expected) {
+			t.Errorf("%d: expected %v, got %d %+v", i, v.expected, page.TotalRecords, list)
+			continue
+		}
+		for j, id := range v.expected {
+			if list[j].Id != id {
+				t.Errorf("%d: expected %v, got %+v", i, v.expected, list)
+			}
+		}
+	}
+}
+
+func query(filtered map[string]interface{}, sorted string) (q common.Query) {
+	for k, v := range filtered {
+		q.SetFiltered(k, v)
+	}
+	q.SetSorted(sorted, false)
+	return
+}
+
+type invoice struct {
+	base.Entity `xorm:"extends"`
+	CustomerId  int64
+}
+
+func TestColumnsWithJoin(t *testing.T) {
+	orm, err := xorm.NewEngine("sqlite3", "file:columnsjoin?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orm.Close()
+	if err = orm.Sync2(new(customer), new(invoice)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = orm.Insert([]customer{{Email: "a@xxxx.cn"}, {Email: "b@xxxx.cn"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = orm.Insert([]invoice{{CustomerId: 2}, {CustomerId: 1}, {CustomerId: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	// Columns生成的id、create_time与关联表customer中的id同名
+	column, err := search.Columns(orm, new(invoice))
+	if err != nil {
+		t.Fatal(err)
+	}
+	column["customerEmail"] = search.Filter{FieldName: "c.email", Operator: search.EQ, Join: &search.Join{Table: "customer", Alias: "c", On: "c.id = invoice.customer_id"}}
+	repo := base.NewBaseRepository(orm, []*xorm.Engine{orm}, column)
+	q := query(map[string]interface{}{"customerEmail": "a@xxxx.cn", "id": []int64{1, 2, 3}, "createTime": []int64{0, 1 << 40}}, "id")
+	var list []invoice
+	page, err := repo.Query(context.Background(), q, &list, new(invoice))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.TotalRecords != 2 || len(list) != 2 || list[0].Id != 2 || list[1].Id != 3 {
+		t.Errorf("unexpected result %d %+v", page.TotalRecords, list)
+	}
+	var rows []struct{ Count int64 }
+	if err = repo.Aggregate(context.Background(), q, new(invoice), nil, []search.Aggregate{{Func: search.COUNT, Id: "id"}}, &rows); err != nil || len(rows) != 1 || rows[0].Count != 2 {
+		t.Errorf("unexpected aggregate %+v %v", rows, err)
+	}
+}
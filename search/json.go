@@ -0,0 +1,69 @@
+package search
+
+import (
+	"encoding/json"
+	"strings"
+
+	"xorm.io/builder"
+)
+
+// JsonPathSeparator 字段名中列与JSON路径的分隔符，如"attrs->$.color"，没有路径时为整个JSON文档("$")
+const JsonPathSeparator = "->"
+
+func splitJsonField(fieldName string) (column, path string) {
+	if idx := strings.Index(fieldName, JsonPathSeparator); idx > 0 {
+		return fieldName[:idx], fieldName[idx+len(JsonPathSeparator):]
+	}
+	return fieldName, "$"
+}
+
+// JsonField 生成JSON操作符使用的字段名
+func JsonField(column, path string) string {
+	return column + JsonPathSeparator + path
+}
+
+var jsonEQ = ByDialect(map[string]CondFunc{
+	builder.MYSQL: func(fieldName string, value interface{}, _ string) builder.Cond {
+		column, path := splitJsonField(fieldName)
+		return builder.Expr("JSON_UNQUOTE(JSON_EXTRACT("+column+", ?)) = ?", path, toString(value))
+	},
+	builder.SQLITE: func(fieldName string, value interface{}, _ string) builder.Cond {
+		column, path := splitJsonField(fieldName)
+		return builder.Expr("json_extract("+column+", ?) = ?", path, value)
+	},
+})
+
+// jsonContains 路径对应的值为数组时判断是否包含给定的值
+var jsonContains = ByDialect(map[string]CondFunc{
+	builder.MYSQL: func(fieldName string, value interface{}, _ string) builder.Cond {
+		column, path := splitJsonField(fieldName)
+		candidate, err := json.Marshal(value)
+		if err != nil {
+			return builder.Expr("1=0")
+		}
+		return builder.Expr("JSON_CONTAINS("+column+", ?, ?)", string(candidate), path)
+	},
+	builder.SQLITE: func(fieldName string, value interface{}, _ string) builder.Cond {
+		column, path := splitJsonField(fieldName)
+		return builder.Expr("EXISTS (SELECT 1 FROM json_each("+column+", ?) WHERE json_each.value = ?)", path, value)
+	},
+})
+
+// jsonHasKey 值为false时判断路径不存在，其他值判断路径存在
+var jsonHasKey = ByDialect(map[string]CondFunc{
+	builder.MYSQL: func(fieldName string, value interface{}, _ string) builder.Cond {
+		column, path := splitJsonField(fieldName)
+		return markExists(builder.Expr("JSON_CONTAINS_PATH("+column+", 'one', ?)", path), value)
+	},
+	builder.SQLITE: func(fieldName string, value interface{}, _ string) builder.Cond {
+		column, path := splitJsonField(fieldName)
+		return markExists(builder.Expr("json_type("+column+", ?) IS NOT NULL", path), value)
+	},
+})
+
+func markExists(cond builder.Cond, value interface{}) builder.Cond {
+	if exists, err := toBool(value); err == nil && !exists {
+		return builder.Not{cond}
+	}
+	return cond
+}
@@ -0,0 +1,56 @@
+//go:build sqlite_json || sqlite_json1 || json1
+// +build sqlite_json sqlite_json1 json1
+
+// go-sqlite3 v1.14.7内置的sqlite为3.35.4，JSON1只有在指定构建标签时才会编译
+
+package search_test
+
+import (
+	"testing"
+
+	"github.com/aluka-7/datasource/search"
+	_ "github.com/mattn/go-sqlite3"
+	"xorm.io/xorm"
+)
+
+type product struct {
+	Id    int64
+	Attrs string `xorm:"text"`
+}
+
+func TestJsonOperators(t *testing.T) {
+	orm, err := xorm.NewEngine("sqlite3", "file::memory:?cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orm.Close()
+	if err = orm.Sync2(new(product)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = orm.Insert([]product{
+		{Attrs: `{"color":"red","size":3,"tags":["new","sale"]}`},
+		{Attrs: `{"color":"blue","tags":["sale"]}`},
+		{Attrs: `{"size":5}`},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		filter   search.Filter
+		expected int
+	}{
+		{search.Filter{FieldName: "attrs->$.color", Value: "red", Operator: search.JsonEQ}, 1},
+		{search.Filter{FieldName: "attrs->$.size", Value: "5", Operator: search.JsonEQ, Type: search.TypeInt}, 1},
+		{search.Filter{FieldName: "attrs->$.tags", Value: "sale", Operator: search.JsonContains}, 2},
+		{search.Filter{FieldName: "attrs->$.color", Value: true, Operator: search.JsonHasKey}, 2},
+		{search.Filter{FieldName: "attrs->$.color", Value: false, Operator: search.JsonHasKey}, 1},
+	}
+	for _, v := range tests {
+		var list []product
+		if err = search.OrmFilter([]search.Filter{v.filter}, orm.NewSession()).Find(&list); err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != v.expected {
+			t.Errorf("%s %v: expected %d, got %d", v.filter.Operator, v.filter.Value, v.expected, len(list))
+		}
+	}
+}
@@ -1,110 +1,74 @@
 package search
 
 import (
-	"strings"
-
 	"github.com/aluka-7/common"
 	"github.com/aluka-7/datasource/sort"
 	"xorm.io/builder"
 	"xorm.io/xorm"
 )
 
-// {"pageSize":10,"page":0,"sorted":[{"id":"firstName","desc":false}],"filtered":[{"id":"firstName","value":"3"}]}
+// {"pageSize":10,"page":0,"sorted":[{"id":"firstName","desc":false}],"filtered":[{"id":"firstName","value":"3"},{"or":[...]}]}
 type Query struct {
 	common.Query
+	Filtered []Expression `json:"filtered"` // 覆盖common.Query中的Filtered，支持嵌套的AND/OR/NOT分组，为nil时使用common.Query中的Filtered
 }
 
 func NewQuery(query common.Query) Query {
-	return Query{query}
+	return Query{Query: query, Filtered: leaves(query)}
+}
+
+func leaves(query common.Query) []Expression {
+	filtered := make([]Expression, 0, len(query.Filtered))
+	for _, v := range query.Filtered {
+		filtered = append(filtered, Leaf(v.Id, v.Value))
+	}
+	return filtered
+}
+
+// expressions 过滤条件，直接使用Query{Query: cq}构造(未调用NewQuery)时Filtered为nil，此时使用cq中的Filtered
+func (sp Query) expressions() []Expression {
+	if sp.Filtered == nil {
+		return leaves(sp.Query)
+	}
+	return sp.Filtered
 }
 func (sp Query) MarkOrder(column map[string]Filter) (sorted *sort.Sort) {
 	if len(sp.Sorted) > 0 {
 		sorted = sort.Sorted()
 		for _, v := range sp.Sorted {
+			k, ok := column[v.Id]
+			if !ok || k.NoSort || k.Join != nil && k.Join.Many {
+				continue
+			}
 			if v.Desc {
-				sorted.Desc(column[v.Id].FieldName)
+				sorted.Desc(k.FieldName)
 			} else {
-				sorted.Asc(column[v.Id].FieldName)
+				sorted.Asc(k.FieldName)
 			}
 		}
 	}
 	return
 }
 
-func (sp Query) MarkOrmFiltered(column map[string]Filter, orm *xorm.Session) {
-	if len(sp.Filtered) > 0 {
-		for _, v := range sp.Filtered {
-			if k, ok := column[v.Id]; ok {
-				switch k.Operator {
-				case NE:
-					orm.Where(builder.Neq{k.FieldName: v.Value})
-				case LIKE:
-					orm.Where(builder.Like{k.FieldName, v.Value.(string)})
-				case GT:
-					orm.Where(builder.Gt{k.FieldName: v.Value})
-				case LT:
-					orm.Where(builder.Lt{k.FieldName: v.Value})
-				case GTE:
-					orm.Where(builder.Gte{k.FieldName: v.Value})
-				case LTE:
-					orm.Where(builder.Lte{k.FieldName: v.Value})
-				case IN:
-					orm.Where(markIn(true, k.FieldName, v.Value))
-				case NI:
-					orm.Where(markIn(false, k.FieldName, v.Value))
-				case IsNull:
-					orm.Where(builder.IsNull{k.FieldName})
-				case NotNull:
-					orm.Where(builder.NotNull{k.FieldName})
-				default:
-					orm.Where(builder.Eq{k.FieldName: v.Value})
-				}
-			}
-		}
-	}
+// MarkCond 将过滤条件转换为builder.Cond，多个条件之间使用AND连接，dialect为数据库类型(如mysql、sqlite3)
+func (sp Query) MarkCond(column map[string]Filter, dialect string) (builder.Cond, error) {
+	return Conds(sp.expressions(), column, dialect)
 }
-func (sp Query) MarkSqlFiltered(column map[string]Filter, bu *builder.Builder) {
-	if len(sp.Filtered) > 0 {
-		for _, v := range sp.Filtered {
-			if k, ok := column[v.Id]; ok {
-				switch k.Operator {
-				case NE:
-					bu.Where(builder.Neq{k.FieldName: v.Value})
-				case LIKE:
-					bu.Where(builder.Like{k.FieldName, v.Value.(string)})
-				case GT:
-					bu.Where(builder.Gt{k.FieldName: v.Value})
-				case LT:
-					bu.Where(builder.Lt{k.FieldName: v.Value})
-				case GTE:
-					bu.Where(builder.Gte{k.FieldName: v.Value})
-				case LTE:
-					bu.Where(builder.Lte{k.FieldName: v.Value})
-				case IN:
-					bu.Where(markIn(true, k.FieldName, v.Value))
-				case NI:
-					bu.Where(markIn(false, k.FieldName, v.Value))
-				case IsNull:
-					bu.Where(builder.IsNull{k.FieldName})
-				case NotNull:
-					bu.Where(builder.NotNull{k.FieldName})
-				default:
-					bu.Where(builder.Eq{k.FieldName: v.Value})
-				}
-			}
-		}
+
+// MarkOrmFiltered 过滤条件的值不合法时返回ValidationError，此时不会添加任何条件
+func (sp Query) MarkOrmFiltered(column map[string]Filter, orm *xorm.Session) error {
+	cond, err := sp.MarkCond(column, sessionDialect(orm))
+	if err == nil && cond.IsValid() {
+		orm.Where(cond)
 	}
+	return err
 }
 
-func markIn(isIn bool, fieldName string, value interface{}) builder.Cond {
-	var cond builder.Cond
-	if vs, ok := value.(string); ok {
-		value = strings.Split(vs, ",")
-	}
-	if isIn {
-		cond = builder.In(fieldName, value)
-	} else {
-		cond = builder.NotIn(fieldName, value)
+// MarkSqlFiltered builder.Builder无法获取数据库类型，与方言相关的操作符使用通用的写法
+func (sp Query) MarkSqlFiltered(column map[string]Filter, bu *builder.Builder) error {
+	cond, err := sp.MarkCond(column, "")
+	if err == nil && cond.IsValid() {
+		bu.Where(cond)
 	}
-	return cond
+	return err
 }
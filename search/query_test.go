@@ -0,0 +1,228 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aluka-7/common"
+	"xorm.io/builder"
+)
+
+var testColumn = map[string]Filter{
+	"status": {FieldName: "status", Operator: EQ},
+	"owner":  {FieldName: "owner", Operator: EQ},
+	"draft":  {FieldName: "draft", Operator: EQ},
+	"email":  {FieldName: "email", Operator: LIKE},
+}
+
+func TestQueryNestedFiltered(t *testing.T) {
+	var query Query
+	data := `{"pageSize":10,"page":0,"filtered":[{"id":"email","value":"x"},{"or":[{"id":"status","value":"A"},{"and":[{"id":"owner","value":1},{"id":"draft","value":true}]}]},{"not":{"id":"status","value":"D"}},{"id":"unknown","value":1}]}`
+	if err := json.Unmarshal([]byte(data), &query); err != nil {
+		t.Fatal(err)
+	}
+	cond, err := query.MarkCond(testColumn, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args, err := builder.ToSQL(cond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "email LIKE ? AND (status=? OR (owner=? AND draft=?)) AND NOT status=?"
+	if sql != expected {
+		t.Errorf("expected %q, got %q", expected, sql)
+	}
+	if len(args) != 5 {
+		t.Errorf("expected 5 args, got %v", args)
+	}
+}
+
+func TestQueryCommonFiltered(t *testing.T) {
+	// 未使用NewQuery时使用common.Query中的Filtered
+	var cq common.Query
+	if err := json.Unmarshal([]byte(`{"filtered":[{"id":"status","value":"A"},{"id":"owner","value":1}]}`), &cq); err != nil {
+		t.Fatal(err)
+	}
+	cond, err := Query{Query: cq}.MarkCond(testColumn, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, _, err := builder.ToSQL(cond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "status=? AND owner=?"; sql != expected {
+		t.Errorf("expected %q, got %q", expected, sql)
+	}
+}
+
+func TestQueryMarkSqlFiltered(t *testing.T) {
+	query := Query{Filtered: []Expression{Or(Leaf("status", "A"), Not(Leaf("draft", true)))}}
+	bu := builder.Select("id").From("doc")
+	if err := query.MarkSqlFiltered(testColumn, bu); err != nil {
+		t.Fatal(err)
+	}
+	sql, _, err := bu.ToSQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "SELECT id FROM doc WHERE (status=? OR (NOT draft=?))"
+	if sql != expected {
+		t.Errorf("expected %q, got %q", expected, sql)
+	}
+}
+
+func TestOperatorValueOf(t *testing.T) {
+	for _, v := range []Operator{EQ, NotNull, BETWEEN, NotBetween, StartsWith, EndsWith, Contains, NotLike, ILIKE} {
+		if actual := OperatorValueOf(v.String()); actual != v {
+			t.Errorf("expected %d, got %d", v, actual)
+		}
+	}
+	if actual := OperatorValueOf("UNKNOWN"); actual != 0 {
+		t.Errorf("expected 0, got %d", actual)
+	}
+}
+
+func TestMarkCondOperators(t *testing.T) {
+	tests := []struct {
+		filter  Filter
+		value   interface{}
+		dialect string
+		sql     string
+		args    []interface{}
+	}{
+		{Filter{FieldName: "age", Operator: BETWEEN}, []interface{}{1, 9}, "", "age BETWEEN ? AND ?", []interface{}{1, 9}},
+		{Filter{FieldName: "age", Operator: NotBetween}, "1,9", "", "NOT age BETWEEN ? AND ?", []interface{}{"1", "9"}},
+		{Filter{FieldName: "name", Operator: StartsWith}, "a%b_", "", "name LIKE ? ESCAPE '!'", []interface{}{"a!%b!_%"}},
+		{Filter{FieldName: "name", Operator: EndsWith}, "x!", "", "name LIKE ? ESCAPE '!'", []interface{}{"%x!!"}},
+		{Filter{FieldName: "name", Operator: Contains}, 12, "", "name LIKE ? ESCAPE '!'", []interface{}{"%12%"}},
+		{Filter{FieldName: "name", Operator: NotLike}, "abc", "", "NOT name LIKE ?", []interface{}{"%abc%"}},
+		{Filter{FieldName: "name", Operator: ILIKE}, "Abc", "postgres", "name ILIKE ?", []interface{}{"%Abc%"}},
+		{Filter{FieldName: "name", Operator: ILIKE}, "Abc%", "mysql", "LOWER(name) LIKE LOWER(?)", []interface{}{"Abc%"}},
+	}
+	for _, v := range tests {
+		cond, err := v.filter.Cond(v.value, v.dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sql, args, err := builder.ToSQL(cond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql != v.sql || fmt.Sprint(args) != fmt.Sprint(v.args) {
+			t.Errorf("%s: expected %q %v, got %q %v", v.filter.Operator, v.sql, v.args, sql, args)
+		}
+	}
+}
+
+func TestQueryCoerceValues(t *testing.T) {
+	column := map[string]Filter{
+		"id":         {FieldName: "id", Operator: IN, Type: TypeInt},
+		"createTime": {FieldName: "create_time", Operator: BETWEEN, Type: TypeUnix},
+		"enabled":    {FieldName: "enabled", Operator: EQ, Type: TypeBool},
+		"status":     {FieldName: "status", Operator: EQ, Type: TypeEnum, Enum: []string{"A", "D"}},
+		"email":      {FieldName: "email", Operator: LIKE},
+	}
+	var query Query
+	data := `{"filtered":[{"id":"id","value":"1,2"},{"id":"createTime","value":["2021-06-01",1625097600]},{"id":"enabled","value":"true"},{"id":"status","value":"A"},{"id":"email","value":12}]}`
+	if err := json.Unmarshal([]byte(data), &query); err != nil {
+		t.Fatal(err)
+	}
+	cond, err := query.MarkCond(column, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, args, err := builder.ToSQL(cond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local).Unix()
+	expected := fmt.Sprint([]interface{}{int64(1), int64(2), start, int64(1625097600), true, "A", "%12%"})
+	if fmt.Sprint(args) != expected {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+}
+
+func TestQueryValidationError(t *testing.T) {
+	column := map[string]Filter{
+		"id":     {FieldName: "id", Operator: EQ, Type: TypeInt},
+		"age":    {FieldName: "age", Operator: BETWEEN, Type: TypeInt},
+		"status": {FieldName: "status", Operator: IN, Type: TypeEnum, Enum: []string{"A", "D"}},
+		"email":  {FieldName: "email", Operator: LIKE},
+	}
+	var query Query
+	data := `{"filtered":[{"id":"id","value":1.5},{"or":[{"id":"age","value":[1]},{"id":"status","value":"A,X"}]},{"id":"email","value":{"a":1}}]}`
+	if err := json.Unmarshal([]byte(data), &query); err != nil {
+		t.Fatal(err)
+	}
+	_, err := query.MarkCond(column, "")
+	errs, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if len(errs) != 4 {
+		t.Errorf("expected 4 errors, got %v", errs)
+	}
+}
+
+func TestMarkCondMatch(t *testing.T) {
+	filter := Filter{FieldName: FullTextField("doc", "title", "body"), Operator: MATCH}
+	tests := map[string]string{
+		builder.MYSQL:    "MATCH(doc.title,doc.body) AGAINST(? IN BOOLEAN MODE)",
+		builder.SQLITE:   "doc.id IN (SELECT rowid FROM doc_fts WHERE doc_fts MATCH ?)",
+		builder.POSTGRES: "((doc.title LIKE ? ESCAPE '!') OR (doc.body LIKE ? ESCAPE '!')) AND ((doc.title LIKE ? ESCAPE '!') OR (doc.body LIKE ? ESCAPE '!'))",
+	}
+	args := map[string]string{
+		builder.MYSQL:    `[+"hello" +"go"]`,
+		builder.SQLITE:   `[{title body} : ("hello" AND "go")]`,
+		builder.POSTGRES: `[%hello% %hello% %go% %go%]`,
+	}
+	for dialect, expected := range tests {
+		cond, err := filter.Cond(` hello "go`, dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sql, a, err := builder.ToSQL(cond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql != expected || fmt.Sprint(a) != args[dialect] {
+			t.Errorf("%s: expected %q %s, got %q %v", dialect, expected, args[dialect], sql, a)
+		}
+	}
+}
+
+func TestMarkCondJson(t *testing.T) {
+	tests := []struct {
+		operator Operator
+		value    interface{}
+		dialect  string
+		sql      string
+		args     string
+	}{
+		{JsonEQ, "red", builder.MYSQL, "JSON_UNQUOTE(JSON_EXTRACT(attrs, ?)) = ?", "[$.color red]"},
+		{JsonEQ, "red", builder.SQLITE, "json_extract(attrs, ?) = ?", "[$.color red]"},
+		{JsonContains, "red", builder.MYSQL, "JSON_CONTAINS(attrs, ?, ?)", `["red" $.color]`},
+		{JsonContains, "red", builder.SQLITE, "EXISTS (SELECT 1 FROM json_each(attrs, ?) WHERE json_each.value = ?)", "[$.color red]"},
+		{JsonHasKey, true, builder.MYSQL, "JSON_CONTAINS_PATH(attrs, 'one', ?)", "[$.color]"},
+		{JsonHasKey, "false", builder.SQLITE, "NOT json_type(attrs, ?) IS NOT NULL", "[$.color]"},
+		{JsonEQ, "red", builder.POSTGRES, "1=0", "[]"},
+	}
+	for _, v := range tests {
+		filter := Filter{FieldName: JsonField("attrs", "$.color"), Operator: v.operator}
+		cond, err := filter.Cond(v.value, v.dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sql, args, err := builder.ToSQL(cond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql != v.sql || fmt.Sprint(args) != v.args {
+			t.Errorf("%s %s: expected %q %s, got %q %v", v.operator, v.dialect, v.sql, v.args, sql, args)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"xorm.io/builder"
+)
+
+// 操作符名称会作为Parse中key的前缀，因此只允许字母和数字
+var operatorNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+var (
+	registry      sync.RWMutex
+	operatorNames = make(map[Operator]string)
+	nextOperator  Operator // Register分配的下一个操作符，大于所有已注册(包括RegisterOperator)的操作符
+)
+
+func init() {
+	for i, v := range []string{"EQ", "NE", "LIKE", "GT", "LT", "GTE", "LTE", "IN", "NI", "IsNull", "NotNull",
+		"BETWEEN", "NotBetween", "StartsWith", "EndsWith", "Contains", "NotLike", "ILIKE", "MATCH",
+		"JsonEQ", "JsonContains", "JsonHasKey"} {
+		operatorNames[Operator(i+1)] = v
+	}
+	nextOperator = Operator(len(operatorNames) + 1)
+}
+
+func (o Operator) String() string {
+	registry.RLock()
+	defer registry.RUnlock()
+	return operatorNames[o]
+}
+
+func OperatorValueOf(operator string) Operator {
+	return operatorValueOf(operator, func(a, b string) bool { return a == b })
+}
+
+// operatorValueOfFold 不区分大小写的OperatorValueOf，用于search标签
+func operatorValueOfFold(operator string) Operator {
+	return operatorValueOf(operator, strings.EqualFold)
+}
+func operatorValueOf(operator string, equal func(a, b string) bool) Operator {
+	registry.RLock()
+	defer registry.RUnlock()
+	for o, v := range operatorNames {
+		if equal(v, operator) {
+			return o
+		}
+	}
+	return 0
+}
+
+func compilerOf(operator Operator) (operatorCompiler, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	c, ok := compilers[operator]
+	return c, ok
+}
+
+// RegisterOperator 注册或覆盖操作符的编译方式，所有的查询方法(Query、OrmFilter、BuilderFilter等)都会使用注册后的编译方式，
+// 之后Register分配的操作符不会与operator冲突
+func RegisterOperator(operator Operator, arity Arity, cond CondFunc) {
+	registry.Lock()
+	defer registry.Unlock()
+	compilers[operator] = operatorCompiler{arity: arity, cond: cond}
+	if operator >= nextOperator {
+		nextOperator = operator + 1
+	}
+}
+
+/**
+ * 注册自定义操作符并返回分配的Operator，注册后name可用于OperatorValueOf、Parse的key(如JsonHas_attrs)
+ * 以及search标签的op选项，name只能包含字母和数字且不能与已有操作符重名，如:
+ *   var Regexp = search.MustRegister("Regexp", search.Text, search.ByDialect(map[string]search.CondFunc{
+ *       builder.POSTGRES: func(f string, v interface{}, _ string) builder.Cond { return builder.Expr(f+" ~ ?", v) },
+ *       "":               func(f string, v interface{}, _ string) builder.Cond { return builder.Expr(f+" REGEXP ?", v) },
+ *   }))
+ */
+func Register(name string, arity Arity, cond CondFunc) (Operator, error) {
+	if !operatorNamePattern.MatchString(name) {
+		return 0, fmt.Errorf("操作符名称[%s]只能包含字母和数字", name)
+	}
+	if cond == nil {
+		return 0, fmt.Errorf("操作符[%s]未指定编译方式", name)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	for _, v := range operatorNames {
+		if strings.EqualFold(v, name) {
+			return 0, fmt.Errorf("操作符[%s]已存在", name)
+		}
+	}
+	operator := nextOperator
+	nextOperator++
+	operatorNames[operator] = name
+	compilers[operator] = operatorCompiler{arity: arity, cond: cond}
+	return operator, nil
+}
+
+// MustRegister 与Register相同，注册失败时panic，用于包级变量的初始化
+func MustRegister(name string, arity Arity, cond CondFunc) Operator {
+	operator, err := Register(name, arity, cond)
+	if err != nil {
+		panic(err)
+	}
+	return operator
+}
+
+// ByDialect 按数据库类型选择编译方式，key为数据库类型(如builder.MYSQL、builder.SQLITE)，""为其他数据库的默认方式，
+// 没有匹配的编译方式时生成恒为假的条件
+func ByDialect(conds map[string]CondFunc) CondFunc {
+	return func(fieldName string, value interface{}, dialect string) builder.Cond {
+		if cond, ok := conds[dialect]; ok {
+			return cond(fieldName, value, dialect)
+		}
+		if cond, ok := conds[""]; ok {
+			return cond(fieldName, value, dialect)
+		}
+		return builder.Expr("1=0")
+	}
+}
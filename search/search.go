@@ -2,6 +2,9 @@ package search
 
 import (
 	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
 	"strings"
 
 	"xorm.io/builder"
@@ -22,121 +25,137 @@ const (
 	NI
 	IsNull
 	NotNull
+	BETWEEN    // 值为两个元素的数组或"min,max"格式的字符串
+	NotBetween // 同BETWEEN
+	StartsWith // 前缀匹配，值中的通配符会被转义
+	EndsWith   // 后缀匹配，值中的通配符会被转义
+	Contains   // 包含匹配，值中的通配符会被转义
+	NotLike
+	ILIKE        // 不区分大小写的LIKE，postgres使用ILIKE，其他数据库使用LOWER模拟
+	MATCH        // 全文检索，字段名使用FullTextField生成，mysql使用MATCH AGAINST，sqlite3使用FTS5虚拟表，其他数据库使用LIKE模拟
+	JsonEQ       // JSON路径的值等于给定的值，字段名格式为"attrs->$.color"，仅支持mysql和sqlite3
+	JsonContains // JSON路径的数组包含给定的值，仅支持mysql和sqlite3
+	JsonHasKey   // JSON路径是否存在，值为false时表示不存在，仅支持mysql和sqlite3
 )
 
-func OperatorValueOf(operator string) Operator {
-	switch operator {
-	case "EQ":
-		return EQ
-	case "NE":
-		return NE
-	case "LIKE":
-		return LIKE
-	case "GT":
-		return GT
-	case "LT":
-		return LT
-	case "GTE":
-		return GTE
-	case "LTE":
-		return LTE
-	case "IN":
-		return IN
-	case "NI":
-		return NI
-	case "IsNull":
-		return IsNull
-	case "NotNull":
-		return NotNull
-	}
-	return 0
-}
-
 type Filter struct {
 	FieldName string
 	Value     interface{}
 	Operator  Operator
+	Type      ValueType // 期望的值类型，用于转换和校验客户端传入的值
+	Enum      []string  // Type为TypeEnum时的可选值
+	NoSort    bool      // 禁止按该字段排序
+	Join      *Join     // 字段所属的关联表，为nil时为主表的字段
 }
 
+// 字段名只允许字母、数字和下划线，可以使用"."限定关联表，如user.email，JSON列可以使用"->"指定路径，如attrs->$.color
+var fieldNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?(->\$(\.[A-Za-z_][A-Za-z0-9_]*|\[[0-9]+\])*)?$`)
+
 /**
- * searchParams中key的格式为OPERATOR_FIELDNAME
+ * searchParams中key的格式为OPERATOR_FIELDNAME，只按第一个"_"拆分，如EQ_login_name、GTE_create_time、EQ_user.email，
+ * 值为nil的参数会被忽略，操作符未知或字段名不合法时返回ValidationError，其中包含所有不合法的参数
  */
-func Parse(searchParams map[string]interface{}) (filters []Filter) {
-	filters = make([]Filter, len(searchParams))
-	index := 0
+func Parse(searchParams map[string]interface{}) (filters []Filter, err error) {
+	keys := make([]string, 0, len(searchParams))
 	for k, v := range searchParams {
 		// 过滤掉空值
-		if v == nil {
-			continue
+		if v != nil {
+			keys = append(keys, k)
 		}
-		// 拆分operator与filedAttribute
-		names := strings.Split(k, "_")
-		if len(names) != 2 {
-			fmt.Printf("%s is not a valid search filter name\n", k)
+	}
+	sort.Strings(keys)
+	filters = make([]Filter, 0, len(keys))
+	var errs ValidationError
+	for _, k := range keys {
+		filter, reason := parseKey(k)
+		if len(reason) > 0 {
+			errs = append(errs, FilterError{Id: k, Value: searchParams[k], Reason: reason})
 			continue
 		}
-		filedName := names[1]
-		operator := OperatorValueOf(names[0])
-		filters[index] = Filter{FieldName: filedName, Value: v, Operator: operator}
-		index++
+		filter.Value = searchParams[k]
+		filters = append(filters, filter)
+	}
+	if len(errs) > 0 {
+		err = errs
 	}
 	return
 }
 
-func OrmFilter(filters []Filter, orm *xorm.Session) *xorm.Session {
-	for _, filter := range filters {
-		switch filter.Operator {
-		case EQ:
-			orm.Where(builder.Eq{filter.FieldName: filter.Value})
-		case NE:
-			orm.Where(builder.Neq{filter.FieldName: filter.Value})
-		case LIKE:
-			orm.Where(builder.Like{filter.FieldName, filter.Value.(string)})
-		case GT:
-			orm.Where(builder.Gt{filter.FieldName: filter.Value})
-		case LT:
-			orm.Where(builder.Lt{filter.FieldName: filter.Value})
-		case GTE:
-			orm.Where(builder.Gte{filter.FieldName: filter.Value})
-		case LTE:
-			orm.Where(builder.Lte{filter.FieldName: filter.Value})
-		case IN:
-			orm.Where(builder.In(filter.FieldName, filter.Value))
-		case NI:
-			orm.Where(builder.NotIn(filter.FieldName, filter.Value))
-		case IsNull:
-			orm.Where(builder.IsNull{filter.FieldName})
-		case NotNull:
-			orm.Where(builder.NotNull{filter.FieldName})
+// ParseValues 解析HTTP请求中的参数，key的格式与Parse相同，空字符串会被忽略，
+// IN、NI、BETWEEN、NotBetween使用参数的所有值，其他操作符只使用第一个值
+func ParseValues(values url.Values) ([]Filter, error) {
+	searchParams := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if len(v) == 0 || len(v) == 1 && len(v[0]) == 0 {
+			continue
 		}
+		switch filter, _ := parseKey(k); filter.Operator {
+		case IN, NI, BETWEEN, NotBetween:
+			if len(v) > 1 {
+				searchParams[k] = v
+				continue
+			}
+		}
+		searchParams[k] = v[0]
+	}
+	return Parse(searchParams)
+}
+
+// parseKey 拆分operator与filedAttribute，不合法时返回原因
+func parseKey(key string) (Filter, string) {
+	names := strings.SplitN(key, "_", 2)
+	if len(names) != 2 {
+		return Filter{}, "不是合法的OPERATOR_FIELDNAME格式"
 	}
-	return orm
+	operator := OperatorValueOf(names[0])
+	if operator == 0 {
+		return Filter{}, fmt.Sprintf("未知的操作符[%s]", names[0])
+	}
+	if !fieldNamePattern.MatchString(names[1]) {
+		return Filter{}, fmt.Sprintf("不合法的字段名[%s]", names[1])
+	}
+	return Filter{FieldName: names[1], Operator: operator}, ""
+}
+
+// OrmFilter 将过滤条件添加到session中，过滤条件不合法时session执行查询(如Find)会返回该错误，提前获取错误时请使用Compile
+func OrmFilter(filters []Filter, orm *xorm.Session) *xorm.Session {
+	return orm.Where(compileOrError(filters, sessionDialect(orm)))
 }
+
+// BuilderFilter 与OrmFilter相同，过滤条件不合法时bu.ToSQL返回该错误，builder.Builder无法获取数据库类型，与方言相关的操作符使用通用的写法
 func BuilderFilter(filters []Filter, bu *builder.Builder) {
-	for _, filter := range filters {
-		switch filter.Operator {
-		case EQ:
-			bu.Where(builder.Eq{filter.FieldName: filter.Value})
-		case NE:
-			bu.Where(builder.Neq{filter.FieldName: filter.Value})
-		case LIKE:
-			bu.Where(builder.Like{filter.FieldName, filter.Value.(string)})
-		case GT:
-			bu.Where(builder.Gt{filter.FieldName: filter.Value})
-		case LT:
-			bu.Where(builder.Lt{filter.FieldName: filter.Value})
-		case GTE:
-			bu.Where(builder.Gte{filter.FieldName: filter.Value})
-		case LTE:
-			bu.Where(builder.Lte{filter.FieldName: filter.Value})
-		case IN:
-			bu.Where(builder.In(filter.FieldName, filter.Value))
-		case NI:
-			bu.Where(builder.NotIn(filter.FieldName, filter.Value))
-		case IsNull:
-			bu.Where(builder.IsNull{filter.FieldName})
-		case NotNull:
-			bu.Where(builder.NotNull{filter.FieldName})
-		}
+	bu.Where(compileOrError(filters, ""))
+}
+
+// compileOrError 编译失败时返回生成SQL时会返回该错误的条件，使调用方执行查询时得到错误而不是空的结果
+func compileOrError(filters []Filter, dialect string) builder.Cond {
+	cond, err := Compile(filters, dialect)
+	if err != nil {
+		return errCond{err}
 	}
+	return cond
+}
+
+type errCond struct {
+	err error
+}
+
+func (c errCond) WriteTo(builder.Writer) error {
+	return c.err
+}
+
+func (c errCond) And(conds ...builder.Cond) builder.Cond {
+	return builder.And(c, builder.And(conds...))
+}
+
+func (c errCond) Or(conds ...builder.Cond) builder.Cond {
+	return builder.Or(c, builder.Or(conds...))
+}
+
+func (c errCond) IsValid() bool {
+	return true
+}
+
+func sessionDialect(orm *xorm.Session) string {
+	return string(orm.Engine().Dialect().URI().DBType)
 }
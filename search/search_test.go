@@ -0,0 +1,180 @@
+package search
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+
+	"xorm.io/builder"
+	"xorm.io/xorm"
+)
+
+func TestParse(t *testing.T) {
+	filters, err := Parse(map[string]interface{}{
+		"EQ_login_name":         "admin",
+		"GTE_create_time":       1625097600,
+		"EQ_user.email":         "a@xxxx.cn",
+		"NotNull_email":         true,
+		"LIKE_name":             nil,
+		"JsonEQ_attrs->$.color": "red",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Filter{
+		{FieldName: "login_name", Value: "admin", Operator: EQ},
+		{FieldName: "user.email", Value: "a@xxxx.cn", Operator: EQ},
+		{FieldName: "create_time", Value: 1625097600, Operator: GTE},
+		{FieldName: "attrs->$.color", Value: "red", Operator: JsonEQ},
+		{FieldName: "email", Value: true, Operator: NotNull},
+	}
+	if fmt.Sprint(filters) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, filters)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	filters, err := Parse(map[string]interface{}{
+		"EQ_name":        "admin",
+		"name":           "admin",
+		"XX_name":        "admin",
+		"EQ_name;DROP x": "admin",
+	})
+	errs, ok := err.(ValidationError)
+	if !ok || len(errs) != 3 {
+		t.Errorf("expected 3 errors, got %v", err)
+	}
+	if len(filters) != 1 || filters[0].FieldName != "name" {
+		t.Errorf("expected valid filters to be kept, got %v", filters)
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	values, _ := url.ParseQuery("IN_id=1&IN_id=2&BETWEEN_create_time=1,2&EQ_login_name=admin&EQ_email=")
+	filters, err := ParseValues(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Filter{
+		{FieldName: "create_time", Value: "1,2", Operator: BETWEEN},
+		{FieldName: "login_name", Value: "admin", Operator: EQ},
+		{FieldName: "id", Value: []string{"1", "2"}, Operator: IN},
+	}
+	if fmt.Sprint(filters) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, filters)
+	}
+}
+
+func TestBuilderFilter(t *testing.T) {
+	bu := builder.Select("id").From("doc")
+	BuilderFilter([]Filter{
+		{FieldName: "status", Value: "A"},
+		{FieldName: "id", Value: "1,2", Operator: IN, Type: TypeInt},
+		{FieldName: "email", Value: 12, Operator: LIKE},
+	}, bu)
+	sql, args, err := bu.ToSQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "SELECT id FROM doc WHERE status=? AND id IN (?,?) AND email LIKE ?"; sql != expected {
+		t.Errorf("expected %q, got %q", expected, sql)
+	}
+	if expected := fmt.Sprint([]interface{}{"A", int64(1), int64(2), "%12%"}); fmt.Sprint(args) != expected {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+
+	bu = builder.Select("id").From("doc")
+	BuilderFilter([]Filter{{FieldName: "id", Value: "x", Operator: EQ, Type: TypeInt}}, bu)
+	if _, _, err = bu.ToSQL(); err == nil {
+		t.Error("expected invalid filters to return an error")
+	}
+}
+
+func TestOrmFilter(t *testing.T) {
+	orm, err := xorm.NewEngine("sqlite3", "file:ormfilter?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orm.Close()
+	var ids []int64
+	err = OrmFilter([]Filter{{FieldName: "id", Value: "x", Operator: EQ, Type: TypeInt}}, orm.Table("doc").Cols("id")).Find(&ids)
+	if _, ok := err.(ValidationError); !ok {
+		t.Errorf("expected ValidationError, got %v", err)
+	}
+}
+
+func TestRegisterOperator(t *testing.T) {
+	const regexp Operator = 100
+	RegisterOperator(regexp, Text, func(fieldName string, value interface{}, dialect string) builder.Cond {
+		if dialect == builder.POSTGRES {
+			return builder.Expr(fieldName+" ~ ?", value)
+		}
+		return builder.Expr(fieldName+" REGEXP ?", value)
+	})
+	defer delete(compilers, regexp)
+	cond, err := Compile([]Filter{{FieldName: "name", Value: "^a", Operator: regexp}}, builder.MYSQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql, _, _ := builder.ToSQL(cond); sql != "(name REGEXP ?)" {
+		t.Errorf("expected %q, got %q", "(name REGEXP ?)", sql)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	jsonPath := MustRegister("JsonPath", Text, ByDialect(map[string]CondFunc{
+		builder.MYSQL: func(fieldName string, value interface{}, _ string) builder.Cond {
+			return builder.Expr("JSON_CONTAINS_PATH("+fieldName+", 'one', ?)", "$."+value.(string))
+		},
+		builder.SQLITE: func(fieldName string, value interface{}, _ string) builder.Cond {
+			return builder.Expr("json_type("+fieldName+", ?) IS NOT NULL", "$."+value.(string))
+		},
+	}))
+	t.Cleanup(func() { unregister(jsonPath) })
+	if OperatorValueOf("JsonPath") != jsonPath || jsonPath.String() != "JsonPath" {
+		t.Errorf("expected JsonPath to be registered as %d", jsonPath)
+	}
+	// RegisterOperator和Register使用同一个计数器分配操作符
+	RegisterOperator(jsonPath+1, Text, ByDialect(nil))
+	t.Cleanup(func() { unregister(jsonPath + 1) })
+	if next := MustRegister("JsonNext", Text, ByDialect(nil)); next == jsonPath+1 {
+		t.Errorf("Register reused operator %d registered by RegisterOperator", next)
+	} else {
+		t.Cleanup(func() { unregister(next) })
+	}
+	if _, err := Register("jsonpath", Text, ByDialect(nil)); err == nil {
+		t.Error("expected duplicate operator error")
+	}
+	if _, err := Register("Json_Path", Text, ByDialect(nil)); err == nil {
+		t.Error("expected invalid operator name error")
+	}
+	filters, err := Parse(map[string]interface{}{"JsonPath_attrs": "color"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		builder.MYSQL:    "(JSON_CONTAINS_PATH(attrs, 'one', ?))",
+		builder.SQLITE:   "(json_type(attrs, ?) IS NOT NULL)",
+		builder.POSTGRES: "(1=0)",
+	}
+	for dialect, expected := range tests {
+		cond, err := Compile(filters, dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql, _, _ := builder.ToSQL(cond); sql != expected {
+			t.Errorf("%s: expected %q, got %q", dialect, expected, sql)
+		}
+	}
+	if _, filter, err := parseTag("attrs,op=jsonpath", "Attrs"); err != nil || filter.Operator != jsonPath {
+		t.Errorf("expected search tag to resolve JsonPath, got %v %v", filter.Operator, err)
+	}
+}
+
+// unregister 删除测试中注册的操作符，使测试可以重复执行
+func unregister(operator Operator) {
+	registry.Lock()
+	defer registry.Unlock()
+	delete(operatorNames, operator)
+	delete(compilers, operator)
+}
@@ -0,0 +1,246 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aluka-7/utils"
+)
+
+// ValueType 过滤条件期望的值类型，客户端传入的JSON值会按照该类型进行转换和校验
+type ValueType int
+
+const (
+	TypeAny    ValueType = iota // 不做转换，保持原值
+	TypeString                  // 字符串，数字和布尔值会被转换为字符串
+	TypeInt                     // 整数，接受整数值的数字和字符串
+	TypeFloat                   // 浮点数
+	TypeBool                    // 布尔值，接受true/false/1/0
+	TypeTime                    // 时间(time.Time)，接受日期字符串和unix秒
+	TypeUnix                    // unix秒(int64)，用于base.Entity中的CreateTime等字段，接受日期字符串和unix秒
+	TypeEnum                    // 枚举，值必须在Filter.Enum中
+)
+
+// 日期字符串支持的格式，按顺序尝试解析，使用本地时区
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// FilterError 单个过滤条件的校验错误
+type FilterError struct {
+	Id     string
+	Value  interface{}
+	Reason string
+}
+
+func (e FilterError) Error() string {
+	return fmt.Sprintf("%s(%v):%s", e.Id, e.Value, e.Reason)
+}
+
+// ValidationError 过滤条件校验失败时返回，包含所有不合法的过滤条件
+type ValidationError []FilterError
+
+func (v ValidationError) Error() string {
+	errs := make([]string, 0, len(v))
+	for _, e := range v {
+		errs = append(errs, e.Error())
+	}
+	return "非法的过滤条件:" + strings.Join(errs, ";")
+}
+
+// markValue 按照操作符需要的值的形式和过滤条件的值类型转换客户端传入的值
+func markValue(arity Arity, k Filter, value interface{}) (interface{}, error) {
+	switch arity {
+	case NoValue:
+		return nil, nil
+	case Multiple, Pair:
+		values := splitValues(value)
+		if arity == Pair && len(values) != 2 {
+			return nil, fmt.Errorf("需要两个值")
+		}
+		for i, v := range values {
+			cv, err := k.Type.Coerce(v, k.Enum)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = cv
+		}
+		return values, nil
+	case Text:
+		if !isScalar(value) {
+			return nil, fmt.Errorf("不是字符串")
+		}
+		return toString(value), nil
+	default:
+		return k.Type.Coerce(value, k.Enum)
+	}
+}
+
+// splitValues 将逗号分隔的字符串或数组转换为[]interface{}
+func splitValues(value interface{}) []interface{} {
+	if vs, ok := value.(string); ok {
+		ss := strings.Split(vs, ",")
+		values := make([]interface{}, len(ss))
+		for i, v := range ss {
+			values[i] = v
+		}
+		return values
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []interface{}{value}
+	}
+	values := make([]interface{}, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values
+}
+
+func isScalar(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct, reflect.Ptr:
+		_, ok := value.(time.Time)
+		return ok
+	}
+	return true
+}
+
+// Coerce 将值转换为当前类型，无法转换时返回错误，enum仅用于TypeEnum
+func (t ValueType) Coerce(value interface{}, enum []string) (interface{}, error) {
+	if t == TypeAny || value == nil {
+		return value, nil
+	}
+	if !isScalar(value) {
+		return nil, fmt.Errorf("不是单个值")
+	}
+	switch t {
+	case TypeString:
+		return toString(value), nil
+	case TypeInt:
+		return toInt(value)
+	case TypeFloat:
+		return toFloat(value)
+	case TypeBool:
+		return toBool(value)
+	case TypeTime:
+		return toTime(value)
+	case TypeUnix:
+		tm, err := toTime(value)
+		if err != nil {
+			return nil, err
+		}
+		return tm.Unix(), nil
+	case TypeEnum:
+		vs := toString(value)
+		if len(enum) > 0 && utils.ContainsString(enum, vs) == -1 {
+			return nil, fmt.Errorf("不是可选值[%s]之一", strings.Join(enum, ","))
+		}
+		return vs, nil
+	}
+	return value, nil
+}
+
+func toInt(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), nil
+		}
+	case uint:
+		if uint64(v) <= math.MaxInt64 {
+			return int64(v), nil
+		}
+	case float32:
+		return toInt(float64(v))
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return int64(v), nil
+		}
+	case json.Number:
+		return toInt(string(v))
+	case string:
+		if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("不是整数")
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case json.Number:
+		return toFloat(string(v))
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, nil
+		}
+	case bool:
+	default:
+		if i, err := toInt(value); err == nil {
+			return float64(i), nil
+		}
+	}
+	return 0, fmt.Errorf("不是数字")
+}
+
+func toBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+			return b, nil
+		}
+	default:
+		if i, err := toInt(value); err == nil && (i == 0 || i == 1) {
+			return i == 1, nil
+		}
+	}
+	return false, fmt.Errorf("不是布尔值")
+}
+
+// toTime 支持time.Time、unix秒(数字或数字字符串)以及timeLayouts中格式的日期字符串
+func toTime(value interface{}) (time.Time, error) {
+	if v, ok := value.(time.Time); ok {
+		return v, nil
+	}
+	if v, ok := value.(string); ok {
+		v = strings.TrimSpace(v)
+		for _, layout := range timeLayouts {
+			if tm, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+				return tm, nil
+			}
+		}
+	}
+	if i, err := toInt(value); err == nil {
+		return time.Unix(i, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("不是合法的时间")
+}
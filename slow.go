@@ -0,0 +1,105 @@
+package datasource
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"xorm.io/xorm/contexts"
+)
+
+// slowQueryHook 记录执行时间超过阈值的语句
+type slowQueryHook struct {
+	dsID      string
+	threshold time.Duration
+	logger    Logger
+	counter   *int64
+}
+
+func (h *slowQueryHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	return c.Ctx, nil
+}
+
+func (h *slowQueryHook) AfterProcess(c *contexts.ContextHook) error {
+	if c.ExecuteTime < h.threshold {
+		return nil
+	}
+	atomic.AddInt64(h.counter, 1)
+	h.logger.Warn("慢查询", "dsID", h.dsID, "sql", c.SQL, "args", RedactArgs(c.Args),
+		"duration", c.ExecuteTime, "threshold", h.threshold, "caller", caller())
+	return nil
+}
+
+/**
+ * 隐藏语句参数中可能包含敏感信息的值，字符串和字节数组只保留长度，数值、布尔值、时间和nil保持不变。
+ */
+func RedactArgs(args []interface{}) []interface{} {
+	redacted := make([]interface{}, len(args))
+	for i, v := range args {
+		switch a := v.(type) {
+		case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, time.Time:
+			redacted[i] = a
+		case string:
+			redacted[i] = fmt.Sprintf("<string(%d)>", len(a))
+		case []byte:
+			redacted[i] = fmt.Sprintf("<bytes(%d)>", len(a))
+		default:
+			redacted[i] = fmt.Sprintf("<%T>", a)
+		}
+	}
+	return redacted
+}
+
+// 这些包中的调用不是业务代码的调用位置
+var callerSkips = []string{"xorm.io/", "database/sql", "github.com/aluka-7/datasource.", "github.com/aluka-7/datasource/", "runtime."}
+
+// caller 执行语句的业务代码位置，格式为file:line
+func caller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		skip := false
+		for _, v := range callerSkips {
+			if strings.HasPrefix(frame.Function, v) {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// slowCounter 获取数据源的慢查询计数器，不存在时创建
+func (d *dataSource) slowCounter(dsID string) *int64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.slowQueries == nil {
+		d.slowQueries = make(map[string]*int64)
+	}
+	counter, ok := d.slowQueries[dsID]
+	if !ok {
+		counter = new(int64)
+		d.slowQueries[dsID] = counter
+	}
+	return counter
+}
+
+// SlowQueries 各数据源自创建以来的慢查询次数，只包含配置了slowQuery(Config.SlowQuery)的数据源
+func (d *dataSource) SlowQueries() map[string]int64 {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	counts := make(map[string]int64, len(d.slowQueries))
+	for k, v := range d.slowQueries {
+		counts[k] = atomic.LoadInt64(v)
+	}
+	return counts
+}
@@ -24,11 +24,21 @@ func (d Direction) ToString() string {
 	return direction[d]
 }
 
+// NullHandling 空值在排序结果中的位置
+type NullHandling int
+
+const (
+	NullsNative NullHandling = iota // 使用数据库默认的空值排序
+	NullsFirst                      // 空值排在最前面
+	NullsLast                       // 空值排在最后面
+)
+
 var Ordered = Order{}
 
 type Order struct {
 	direction Direction
 	property  string
+	nulls     NullHandling
 }
 
 func (o Order) By(property string) Order {
@@ -47,6 +57,43 @@ func (o Order) Asc(property string) Order {
 func (o Order) Desc(property string) Order {
 	return Order{direction: DESC, property: property}
 }
+func (o Order) Nulls(nulls NullHandling) Order {
+	o.nulls = nulls
+	return o
+}
+func (o Order) Direction() Direction {
+	return o.direction
+}
+func (o Order) Property() string {
+	return o.property
+}
+func (o Order) NullOrder() NullHandling {
+	return o.nulls
+}
+
+// ToSql 按照指定数据库方言输出单个排序项，不支持NULLS FIRST/LAST语法的数据库使用CASE表达式模拟
+func (o Order) ToSql(dialect string) string {
+	direction := o.direction
+	if direction != DESC {
+		direction = ASC
+	}
+	str := o.property + " " + direction.ToString()
+	if o.nulls == NullsNative {
+		return str
+	}
+	switch dialect {
+	case "postgres", "oracle":
+		if o.nulls == NullsFirst {
+			return str + " NULLS FIRST"
+		}
+		return str + " NULLS LAST"
+	default:
+		if o.nulls == NullsFirst {
+			return "CASE WHEN " + o.property + " IS NULL THEN 0 ELSE 1 END," + str
+		}
+		return "CASE WHEN " + o.property + " IS NULL THEN 1 ELSE 0 END," + str
+	}
+}
 
 func Sorted() *Sort {
 	return &Sort{orders: make([]Order, 0)}
@@ -81,6 +128,35 @@ func (s *Sort) Desc(property string) *Sort {
 	s.orders = append(s.orders, Ordered.Desc(property))
 	return s
 }
+
+// Nulls 设置最后添加的排序项的空值位置，如Sorted().Desc("id").Nulls(NullsLast)
+func (s *Sort) Nulls(nulls NullHandling) *Sort {
+	if l := len(s.orders); l > 0 {
+		s.orders[l-1] = s.orders[l-1].Nulls(nulls)
+	}
+	return s
+}
+func (s *Sort) Orders() []Order {
+	return s.orders
+}
+
+// ToSql 按照添加的顺序输出排序语句，每个属性使用各自的排序方向，如"id DESC,user ASC,code DESC"，
+// dialect为xorm的数据库类型(mysql、sqlite3、postgres、mssql、oracle)，用于处理NULLS FIRST/LAST。
+func (s *Sort) ToSql(dialect string) string {
+	var str strings.Builder
+	for i, v := range s.orders {
+		if i > 0 {
+			str.WriteString(",")
+		}
+		str.WriteString(v.ToSql(dialect))
+	}
+	return str.String()
+}
+func (s *Sort) String() string {
+	return s.ToSql("")
+}
+
+// Deprecated: 会将所有DESC属性排在ASC属性之前，改变多列排序的语义，请使用ToSql。
 func (s *Sort) ToString() (str string) {
 	// faster than bytes.Buffer
 	var asc, desc strings.Builder
@@ -109,6 +185,7 @@ func (s *Sort) ToString() (str string) {
 	return
 }
 
+// Deprecated: 会将所有ASC属性排在DESC属性之前，改变多列排序的语义，请使用ToSql。
 func (s *Sort) FirstAscString() (str string) {
 	// faster than bytes.Buffer
 	var asc, desc strings.Builder
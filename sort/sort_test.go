@@ -24,3 +24,28 @@ func TestSortedProperty(t *testing.T) {
 	fmt.Println(sorted.ToString())
 	fmt.Println(sorted.FirstAscString())
 }
+
+func TestSortedToSql(t *testing.T) {
+	sorted := Sorted().Desc("id").Asc("user").Desc("code")
+	if actual, expected := sorted.ToSql("mysql"), "id DESC,user ASC,code DESC"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if actual, expected := Sorted().By("id").String(), "id ASC"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestSortedNulls(t *testing.T) {
+	sorted := Sorted().Desc("id").Nulls(NullsLast).Asc("user").Nulls(NullsFirst).Asc("code")
+	tests := map[string]string{
+		"postgres": "id DESC NULLS LAST,user ASC NULLS FIRST,code ASC",
+		"oracle":   "id DESC NULLS LAST,user ASC NULLS FIRST,code ASC",
+		"mysql":    "CASE WHEN id IS NULL THEN 1 ELSE 0 END,id DESC,CASE WHEN user IS NULL THEN 0 ELSE 1 END,user ASC,code ASC",
+		"sqlite3":  "CASE WHEN id IS NULL THEN 1 ELSE 0 END,id DESC,CASE WHEN user IS NULL THEN 0 ELSE 1 END,user ASC,code ASC",
+	}
+	for dialect, expected := range tests {
+		if actual := sorted.ToSql(dialect); actual != expected {
+			t.Errorf("%s: expected %q, got %q", dialect, expected, actual)
+		}
+	}
+}
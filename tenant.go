@@ -0,0 +1,174 @@
+package datasource
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aluka-7/datasource/base"
+	"xorm.io/xorm"
+)
+
+// TenantRoute 租户的路由，DsID不为空时使用该数据源(独立数据库，需要有该数据源的访问权限)，
+// 否则使用默认数据源；Prefix不为空时替换数据源配置中的表名前缀(独立schema或表前缀)
+type TenantRoute struct {
+	DsID   string
+	Prefix string
+}
+
+// TenantRouter 根据租户获取路由，租户不存在时应返回错误
+type TenantRouter func(tenantId string) (TenantRoute, error)
+
+// 被淘汰的引擎默认的延迟关闭时间，见SetCloseDelay
+const tenantCloseDelay = time.Minute
+
+/**
+ * 按照上下文中的租户(见base.WithTenant)获取数据库引擎，实现了base.EngineResolver，
+ * 相同路由的租户共用一个引擎，最多保留capacity个引擎，超出时淘汰最久未使用的引擎。
+ * 被淘汰的引擎延迟关闭，已获取该引擎的请求可以继续执行；到期时仍有使用中的连接(如未结束的事务)则继续延迟，
+ * 持有引擎超过延迟时间且到期时没有使用中连接的请求，之后执行的语句会失败。
+ */
+type TenantResolver struct {
+	ds         *dataSource
+	dsID       string
+	router     TenantRouter
+	capacity   int
+	closeDelay time.Duration
+	lock       sync.Mutex
+	lru        *list.List // 元素为*tenantEngine，最近使用的在前
+	engines    map[TenantRoute]*list.Element
+	closing    map[*tenantEngine]*time.Timer // 已淘汰、等待关闭的引擎
+}
+
+type tenantEngine struct {
+	route  TenantRoute
+	engine *xorm.Engine
+}
+
+/**
+ * 创建按租户路由的引擎解析器，dsID为路由中DsID为空时使用的默认数据源，为空则是当前系统的数据源。
+ * capacity小于1时不限制引擎的数量。
+ */
+func (d *dataSource) Tenant(dsID string, router TenantRouter, capacity int) *TenantResolver {
+	return &TenantResolver{ds: d, dsID: dsID, router: router, capacity: capacity, closeDelay: tenantCloseDelay,
+		lru: list.New(), engines: make(map[TenantRoute]*list.Element), closing: make(map[*tenantEngine]*time.Timer)}
+}
+
+// SetCloseDelay 设置被淘汰的引擎延迟关闭的时间，默认为1分钟，应大于请求持有引擎的时间
+func (r *TenantResolver) SetCloseDelay(delay time.Duration) {
+	r.lock.Lock()
+	r.closeDelay = delay
+	r.lock.Unlock()
+}
+
+func (r *TenantResolver) Master(ctx context.Context) (*xorm.Engine, error) {
+	tenantId, ok := base.TenantFrom(ctx)
+	if !ok {
+		return nil, base.ErrNoTenant
+	}
+	route, err := r.router(tenantId)
+	if err != nil {
+		return nil, err
+	}
+	if len(route.DsID) == 0 {
+		route.DsID = r.dsID
+	}
+	return r.engine(route)
+}
+
+// Replica 数据源配置中没有只读库，与Master相同
+func (r *TenantResolver) Replica(ctx context.Context) (*xorm.Engine, error) {
+	return r.Master(ctx)
+}
+
+// Close 关闭所有引擎，包括等待关闭的引擎
+func (r *TenantResolver) Close() error {
+	r.lock.Lock()
+	engines := make([]*tenantEngine, 0, r.lru.Len()+len(r.closing))
+	for e := r.lru.Front(); e != nil; e = e.Next() {
+		engines = append(engines, e.Value.(*tenantEngine))
+	}
+	for te, timer := range r.closing {
+		timer.Stop()
+		engines = append(engines, te)
+	}
+	r.lru.Init()
+	r.engines = make(map[TenantRoute]*list.Element)
+	r.closing = make(map[*tenantEngine]*time.Timer)
+	r.lock.Unlock()
+	var err error
+	for _, te := range engines {
+		if ex := r.ds.Close(te.engine); ex != nil {
+			err = ex
+		}
+	}
+	return err
+}
+
+/**
+ * 获取路由的引擎，不存在时在锁外读取配置并创建引擎，避免阻塞其他租户，
+ * 同一路由并发创建时保留先加入的引擎，关闭多余的引擎。
+ */
+func (r *TenantResolver) engine(route TenantRoute) (*xorm.Engine, error) {
+	r.lock.Lock()
+	if e, ok := r.engines[route]; ok {
+		r.lru.MoveToFront(e)
+		r.lock.Unlock()
+		return e.Value.(*tenantEngine).engine, nil
+	}
+	r.lock.Unlock()
+	c, dsID, err := r.ds.getConfiguration(route.DsID, r.ds.systemId)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Dsn) == 0 {
+		return nil, fmt.Errorf("数据源[%s]未配置dsn", dsID)
+	}
+	if len(route.Prefix) > 0 {
+		c.Prefix = route.Prefix
+	}
+	eng, err := r.ds.newEngine(dsID, c)
+	if err != nil {
+		return nil, err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if e, ok := r.engines[route]; ok {
+		r.lru.MoveToFront(e)
+		if err := r.ds.Close(eng); err != nil {
+			r.ds.logger.Error(err, "关闭租户的引擎失败", "dsID", route.DsID, "prefix", route.Prefix)
+		}
+		return e.Value.(*tenantEngine).engine, nil
+	}
+	r.engines[route] = r.lru.PushFront(&tenantEngine{route: route, engine: eng})
+	for r.capacity > 0 && r.lru.Len() > r.capacity {
+		oldest := r.lru.Remove(r.lru.Back()).(*tenantEngine)
+		delete(r.engines, oldest.route)
+		r.closeLater(oldest)
+	}
+	return eng, nil
+}
+
+// closeLater 延迟关闭被淘汰的引擎，到期时仍有使用中的连接则继续延迟，调用时需持有锁
+func (r *TenantResolver) closeLater(te *tenantEngine) {
+	r.closing[te] = time.AfterFunc(r.closeDelay, func() {
+		r.lock.Lock()
+		timer, ok := r.closing[te]
+		if !ok { // 已由Close关闭
+			r.lock.Unlock()
+			return
+		}
+		if te.engine.DB().Stats().InUse > 0 {
+			timer.Reset(r.closeDelay)
+			r.lock.Unlock()
+			return
+		}
+		delete(r.closing, te)
+		r.lock.Unlock()
+		if err := r.ds.Close(te.engine); err != nil {
+			r.ds.logger.Error(err, "关闭租户的引擎失败", "dsID", te.route.DsID, "prefix", te.route.Prefix)
+		}
+	})
+}
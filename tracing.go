@@ -0,0 +1,147 @@
+package datasource
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"xorm.io/xorm/contexts"
+)
+
+const tracerName = "github.com/aluka-7/datasource"
+
+// WithTracing 为Orm等方法创建的引擎的每条语句创建链路追踪的span，上级span来自执行语句的上下文(如session.Context(ctx))
+func WithTracing(tp trace.TracerProvider) Option {
+	return func(d *dataSource) {
+		d.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// Dialect对应的db.system
+var dbSystems = map[string]string{"sqlite3": "sqlite", "postgres": "postgresql"}
+
+func dbSystem(dialect string) string {
+	if system, ok := dbSystems[dialect]; ok {
+		return system
+	}
+	return dialect
+}
+
+type spanKey struct{}
+
+/**
+ * tracingHook 每条语句一个span，需要在其他钩子之后添加，只读授权拒绝的语句不会创建span。
+ * xorm在语句执行后、读取结果集之前调用AfterProcess，所以查询语句的span不包含读取结果集的时间，
+ * 也不记录读取的行数，只有执行语句(INSERT、UPDATE等)记录db.rows_affected，读取的行数见base.BaseRepository.Traced。
+ */
+type tracingHook struct {
+	dsID   string
+	system string
+	tracer trace.Tracer
+}
+
+func (h *tracingHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	operation := statementOperation(c.SQL)
+	ctx, span := h.tracer.Start(c.Ctx, operation+" "+h.dsID, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", h.system),
+			attribute.String("db.name", h.dsID),
+			attribute.String("db.operation", operation),
+			attribute.String("db.statement", SanitizeSQL(c.SQL)),
+		))
+	// xorm只使用最后一个钩子返回的上下文，写回c.Ctx使之后的钩子返回带有span的上下文
+	c.Ctx = context.WithValue(ctx, spanKey{}, span)
+	return c.Ctx, nil
+}
+
+func (h *tracingHook) AfterProcess(c *contexts.ContextHook) error {
+	span, ok := c.Ctx.Value(spanKey{}).(trace.Span)
+	if !ok {
+		return nil
+	}
+	if c.Err != nil && c.Err != sql.ErrNoRows {
+		span.RecordError(c.Err)
+		span.SetStatus(codes.Error, ErrorKind(c.Err))
+	} else if c.Result != nil {
+		if n, err := c.Result.RowsAffected(); err == nil {
+			span.SetAttributes(attribute.Int64("db.rows_affected", n))
+		}
+	}
+	span.End()
+	return nil
+}
+
+// statementOperation 语句的第一个关键字，如SELECT
+func statementOperation(sql string) string {
+	fields := strings.Fields(strings.TrimLeft(sql, " \t\r\n("))
+	if len(fields) == 0 {
+		return "SQL"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+/**
+ * 将语句中的字符串和数值字面量替换为?，避免在链路追踪中记录敏感数据，
+ * 标识符(包括`、"和[]中的)以及占位符保持不变，如SELECT * FROM `user` WHERE name='a' AND age>18
+ * 替换为SELECT * FROM `user` WHERE name=? AND age>?
+ */
+func SanitizeSQL(sql string) string {
+	var sb strings.Builder
+	sb.Grow(len(sql))
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'':
+			// 字符串字面量，''和\'为转义
+			for i++; i < len(sql); i++ {
+				if sql[i] == '\\' {
+					i++
+				} else if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						i++
+					} else {
+						break
+					}
+				}
+			}
+			sb.WriteByte('?')
+		case c == '`' || c == '"' || c == '[':
+			end := c
+			if c == '[' {
+				end = ']'
+			}
+			j := strings.IndexByte(sql[i+1:], end)
+			if j < 0 {
+				sb.WriteString(sql[i:])
+				return sb.String()
+			}
+			sb.WriteString(sql[i : i+j+2])
+			i += j + 1
+		case isDigit(c):
+			// 数值字面量，标识符中的数字(包括postgres的占位符$1)在下面整体输出
+			for i+1 < len(sql) && (isIdent(sql[i+1]) || sql[i+1] == '.') {
+				i++
+			}
+			sb.WriteByte('?')
+		case isIdent(c):
+			for ; i < len(sql) && isIdent(sql[i]); i++ {
+				sb.WriteByte(sql[i])
+			}
+			i--
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdent(c byte) bool {
+	return isDigit(c) || c == '_' || c == '$' || c >= 0x80 || (c|0x20) >= 'a' && (c|0x20) <= 'z'
+}